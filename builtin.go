@@ -0,0 +1,90 @@
+package openvvar
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Built-in decoders for standard library types that can't parse themselves from text.
+// Types like net.IP, netip.Addr, netip.Prefix and netip.AddrPort implement encoding.TextUnmarshaler instead
+func init() {
+	RegisterDecoder(reflect.TypeOf(net.IPNet{}), func(data string) (interface{}, error) {
+		network, err := parseIPNet(data)
+		if err != nil {
+			return nil, err
+		}
+		return *network, nil
+	}, formatStringer)
+	RegisterDecoder(reflect.TypeOf(&net.IPNet{}), func(data string) (interface{}, error) {
+		return parseIPNet(data)
+	}, formatStringer)
+
+	RegisterDecoder(reflect.TypeOf(url.URL{}), func(data string) (interface{}, error) {
+		parsed, err := url.Parse(data)
+		if err != nil {
+			return nil, err
+		}
+		return *parsed, nil
+	}, formatStringer)
+	RegisterDecoder(reflect.TypeOf(&url.URL{}), func(data string) (interface{}, error) {
+		return url.Parse(data)
+	}, formatStringer)
+
+	RegisterDecoder(reflect.TypeOf(&regexp.Regexp{}), func(data string) (interface{}, error) {
+		return regexp.Compile(data)
+	}, formatStringer)
+
+	RegisterDecoder(reflect.TypeOf(mail.Address{}), func(data string) (interface{}, error) {
+		address, err := mail.ParseAddress(data)
+		if err != nil {
+			return nil, err
+		}
+		return *address, nil
+	}, formatStringer)
+	RegisterDecoder(reflect.TypeOf(&mail.Address{}), func(data string) (interface{}, error) {
+		return mail.ParseAddress(data)
+	}, formatStringer)
+
+	RegisterDecoder(reflect.TypeOf(os.FileMode(0)), func(data string) (interface{}, error) {
+		mode, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(data), "0o"), 8, 32)
+		if err != nil {
+			return nil, err
+		}
+		return os.FileMode(mode), nil
+	}, func(value interface{}) string {
+		return fmt.Sprintf("%04o", uint32(value.(os.FileMode)))
+	})
+}
+
+// parseIPNet parses a CIDR like "10.0.0.0/8", keeping the network address instead of the given IP
+func parseIPNet(data string) (*net.IPNet, error) {
+	_, network, err := net.ParseCIDR(data)
+	return network, err
+}
+
+// formatStringer formats values of types, or pointers to types, whose pointer implements fmt.Stringer.
+// Nil pointers are shown as an empty string
+func formatStringer(value interface{}) string {
+	if reflected := reflect.ValueOf(value); reflected.Kind() == reflect.Ptr {
+		if reflected.IsNil() {
+			return ""
+		}
+		if stringer, ok := value.(fmt.Stringer); ok {
+			return stringer.String()
+		}
+	}
+
+	pointer := reflect.New(reflect.TypeOf(value))
+	pointer.Elem().Set(reflect.ValueOf(value))
+	if stringer, ok := pointer.Interface().(fmt.Stringer); ok {
+		return stringer.String()
+	}
+	return fmt.Sprintf("%v", value)
+}
@@ -0,0 +1,43 @@
+package openvvar
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// bytesEncodings lists the values of the "encoding=" directive for []byte fields
+var bytesEncodings = map[string]bool{
+	"base64":    true,
+	"base64url": true,
+	"hex":       true,
+	"raw":       true,
+}
+
+// decodeBytes decodes a []byte value with the field encoding. Base64 values may have their padding or not
+func (c converter) decodeBytes(data string) ([]byte, error) {
+	switch c.encoding {
+	case "base64":
+		return base64.RawStdEncoding.DecodeString(strings.TrimRight(data, "="))
+	case "base64url":
+		return base64.RawURLEncoding.DecodeString(strings.TrimRight(data, "="))
+	case "hex":
+		return hex.DecodeString(data)
+	default:
+		return []byte(data), nil
+	}
+}
+
+// encodeBytes shows a []byte value on usage messages and reports with the field encoding
+func (c converter) encodeBytes(data []byte) string {
+	switch c.encoding {
+	case "base64":
+		return base64.StdEncoding.EncodeToString(data)
+	case "base64url":
+		return base64.URLEncoding.EncodeToString(data)
+	case "hex":
+		return hex.EncodeToString(data)
+	default:
+		return string(data)
+	}
+}
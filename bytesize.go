@@ -0,0 +1,162 @@
+package openvvar
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"math/bits"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// bytesUnit is the value of the "unit=" directive parsing integer fields as byte sizes
+const bytesUnit string = "bytes"
+
+// ByteSize is a number of bytes parsed from human readable sizes like "512KiB", "10MB" or "1.5G".
+// SI prefixes (K, M, G, T, P, E) are powers of 1000 and IEC prefixes (Ki, Mi, Gi, Ti, Pi, Ei) are powers of 1024,
+// with an optional "B" suffix, case insensitive. Values without unit are bytes
+type ByteSize uint64
+
+// Byte sizes for both SI and IEC prefixes
+const (
+	Byte     ByteSize = 1
+	Kilobyte          = 1000 * Byte
+	Megabyte          = 1000 * Kilobyte
+	Gigabyte          = 1000 * Megabyte
+	Terabyte          = 1000 * Gigabyte
+	Petabyte          = 1000 * Terabyte
+	Exabyte           = 1000 * Petabyte
+	Kibibyte          = 1024 * Byte
+	Mebibyte          = 1024 * Kibibyte
+	Gibibyte          = 1024 * Mebibyte
+	Tebibyte          = 1024 * Gibibyte
+	Pebibyte          = 1024 * Tebibyte
+	Exbibyte          = 1024 * Pebibyte
+)
+
+// byteUnits lists units from the largest to the smallest, IEC before SI, so sizes are shown with the largest exact one
+var byteUnits = []struct {
+	name string
+	size ByteSize
+}{
+	{"EiB", Exbibyte}, {"EB", Exabyte},
+	{"PiB", Pebibyte}, {"PB", Petabyte},
+	{"TiB", Tebibyte}, {"TB", Terabyte},
+	{"GiB", Gibibyte}, {"GB", Gigabyte},
+	{"MiB", Mebibyte}, {"MB", Megabyte},
+	{"KiB", Kibibyte}, {"KB", Kilobyte},
+}
+
+// ParseByteSize parses a human readable size like "512KiB", "10MB", "1.5G" or "2048"
+func ParseByteSize(data string) (ByteSize, error) {
+	text := strings.TrimSpace(data)
+	idx := strings.IndexFunc(text, func(r rune) bool {
+		return !unicode.IsDigit(r) && r != '.'
+	})
+	if idx == -1 {
+		idx = len(text)
+	}
+
+	number, unit := text[:idx], strings.TrimSpace(text[idx:])
+	if number == "" {
+		return 0, fmt.Errorf("byte size '%s' must start with a number", data)
+	}
+
+	multiplier, found := byteMultiplier(unit)
+	if !found {
+		return 0, fmt.Errorf("unknown byte size unit '%s'", unit)
+	}
+
+	if !strings.Contains(number, ".") {
+		parsed, err := strconv.ParseUint(number, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		high, size := bits.Mul64(parsed, uint64(multiplier))
+		if high != 0 {
+			return 0, fmt.Errorf("byte size '%s' overflows 64 bits: %w", data, strconv.ErrRange)
+		}
+		return ByteSize(size), nil
+	}
+
+	// Decimal sizes are computed exactly, as floats can't represent values like 4.1
+	parsed, ok := new(big.Rat).SetString(number)
+	if !ok {
+		return 0, fmt.Errorf("invalid byte size number '%s'", number)
+	}
+	size := parsed.Mul(parsed, new(big.Rat).SetUint64(uint64(multiplier)))
+	if !size.IsInt() {
+		return 0, fmt.Errorf("byte size '%s' must be a whole number of bytes", data)
+	}
+	if !size.Num().IsUint64() {
+		return 0, fmt.Errorf("byte size '%s' overflows 64 bits: %w", data, strconv.ErrRange)
+	}
+	return ByteSize(size.Num().Uint64()), nil
+}
+
+// parseSize parses a byte size for integer fields with the "unit=bytes" directive, checking it fits their bits
+func parseSize(data string, valueType reflect.Type) (uint64, error) {
+	size, err := ParseByteSize(data)
+	if err != nil {
+		return 0, err
+	}
+
+	limit := uint64(math.MaxUint64) >> (64 - valueType.Bits())
+	if valueType.Kind() >= reflect.Int && valueType.Kind() <= reflect.Int64 {
+		limit >>= 1
+	}
+	if uint64(size) > limit {
+		return 0, fmt.Errorf("byte size '%s' overflows %s: %w", data, valueType, strconv.ErrRange)
+	}
+	return uint64(size), nil
+}
+
+// byteMultipliers maps lower case units, without the "b" suffix, to their size
+var byteMultipliers = map[string]ByteSize{
+	"":   Byte,
+	"k":  Kilobyte,
+	"m":  Megabyte,
+	"g":  Gigabyte,
+	"t":  Terabyte,
+	"p":  Petabyte,
+	"e":  Exabyte,
+	"ki": Kibibyte,
+	"mi": Mebibyte,
+	"gi": Gibibyte,
+	"ti": Tebibyte,
+	"pi": Pebibyte,
+	"ei": Exbibyte,
+}
+
+// byteMultiplier returns the size of a unit like "K", "KB", "Ki" or "KiB", or of bytes for "" and "B"
+func byteMultiplier(unit string) (ByteSize, bool) {
+	multiplier, found := byteMultipliers[strings.TrimSuffix(strings.ToLower(unit), "b")]
+	return multiplier, found
+}
+
+// String shows the size with the largest unit that represents it exactly, like "512KiB" or "1500MB"
+func (b ByteSize) String() string {
+	for _, u := range byteUnits {
+		if b >= u.size && b%u.size == 0 {
+			return fmt.Sprintf("%d%s", b/u.size, u.name)
+		}
+	}
+	return fmt.Sprintf("%dB", uint64(b))
+}
+
+// MarshalText complies with encoding.TextMarshaler, using String
+func (b ByteSize) MarshalText() ([]byte, error) {
+	return []byte(b.String()), nil
+}
+
+// UnmarshalText complies with encoding.TextUnmarshaler, using ParseByteSize
+func (b *ByteSize) UnmarshalText(text []byte) error {
+	size, err := ParseByteSize(string(text))
+	if err != nil {
+		return err
+	}
+	*b = size
+	return nil
+}
@@ -0,0 +1,444 @@
+package openvvar
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// indexPlaceholder stands for the index of slice elements on help, like "-upstreams-<n>-host" or UPSTREAMS_<N>_HOST
+const indexPlaceholder string = "<n>"
+
+// namePlaceholder stands for the key of map elements on help, like "-tenants-<name>-db-host" or TENANTS_<NAME>_DB_HOST
+const namePlaceholder string = "<name>"
+
+// structCollection is a slice or map of structs, whose elements are found on the sources by their index or key,
+// like UPSTREAMS_0_HOST and UPSTREAMS_1_HOST for an Upstreams slice or TENANTS_ACME_DB_HOST for a Tenants map
+type structCollection struct {
+	Name      string
+	Key       string
+	Value     reflect.Value
+	Converter converter
+	// Position is the path of field indices to the collection, where its element fields are sorted
+	Position []int
+}
+
+// collectionElement is an element of a collection, with its index or key as written on the source keys
+type collectionElement struct {
+	Index   string
+	Value   reflect.Value
+	Created bool
+	// Store sets the element back on maps, whose values aren't addressable, nil for slices
+	Store func()
+}
+
+// isStructCollection tells if a type is a slice or a map of structs, or of pointers to structs, parsed field by field
+func (c converter) isStructCollection(valueType reflect.Type) bool {
+	kind := valueType.Kind()
+	if kind != reflect.Slice && kind != reflect.Map || c.isScalar(valueType) {
+		return false
+	}
+
+	elementType := valueType.Elem()
+	if elementType.Kind() == reflect.Ptr && !c.isScalar(elementType) {
+		elementType = elementType.Elem()
+	}
+	return elementType.Kind() == reflect.Struct && !c.isScalar(elementType)
+}
+
+// parseCollection creates the collection for a slice or map of structs field, keyed by its tag or by its field name
+func parseCollection(
+	field reflect.StructField,
+	value reflect.Value,
+	position []int,
+	prefix structPrefix,
+	conv converter,
+) (*structCollection, error) {
+	name := fmt.Sprintf("%s%s", prefix.Name, field.Name)
+	key := changePascalCapsToKebabCase(field.Name)
+
+	if tag := field.Tag.Get("config"); tag != "" {
+		tagKey, directives, err := parseTag(tag)
+		if err != nil {
+			var tagError *InvalidTagError
+			if errors.As(err, &tagError) {
+				tagError.Field = name
+			}
+			return nil, err
+		}
+		if len(directives) > 0 {
+			return nil, &InvalidTagError{
+				Field:     name,
+				Tag:       tag,
+				Directive: directives[0].Name,
+				Reason:    "directive doesn't apply to slices and maps of structs",
+			}
+		}
+		key = strings.ReplaceAll(changePascalCapsToKebabCase(tagKey), "_", "-")
+	}
+
+	return &structCollection{Name: name, Key: prefix.key(key), Value: value, Converter: conv, Position: position}, nil
+}
+
+// elementType returns the struct type of the elements, even for slices of pointers
+func (c *structCollection) elementType() reflect.Type {
+	elementType := c.Value.Type().Elem()
+	if elementType.Kind() == reflect.Ptr {
+		return elementType.Elem()
+	}
+	return elementType
+}
+
+func (c *structCollection) placeholder() string {
+	if c.Value.Kind() == reflect.Map {
+		return namePlaceholder
+	}
+	return indexPlaceholder
+}
+
+// elementPrefix returns the prefix for the fields of an element, at the given position among the collection elements
+func (c *structCollection) elementPrefix(index string, position int) structPrefix {
+	return structPrefix{
+		Name:      fmt.Sprintf("%s[%s].", c.Name, index),
+		Key:       fmt.Sprintf("%s-%s", c.Key, index),
+		InElement: true,
+		Position:  structPrefix{Position: c.Position}.position(position),
+	}
+}
+
+// templateFields returns the fields of an element with a placeholder instead of its index, like "upstreams-<n>-host",
+// including the fields of nested collections. Recursive types stop at their first nested occurrence
+func (c *structCollection) templateFields(visited map[reflect.Type]bool) ([]*fieldConfig, error) {
+	elementType := c.elementType()
+	if visited[elementType] {
+		return nil, nil
+	}
+	visited[elementType] = true
+	defer delete(visited, elementType)
+
+	template, err := parseStruct(reflect.New(elementType).Elem(), c.elementPrefix(c.placeholder(), 0), c.Converter)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := template.Fields
+	for _, nested := range template.Collections {
+		nestedFields, err := nested.templateFields(visited)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, nestedFields...)
+	}
+
+	return fields, nil
+}
+
+// keyPattern matches keys of element fields, capturing the element index or key, like "upstreams-0-host"
+// or "tenants-acme-db-host". Map keys may have dashes, matching as few characters as possible
+func (c *structCollection) keyPattern(templates []*fieldConfig) *regexp.Regexp {
+	placeholders := strings.NewReplacer(indexPlaceholder, `\d+`, namePlaceholder, `.+`)
+	templatePrefix := fmt.Sprintf("%s-%s-", c.Key, c.placeholder())
+
+	index := `\d+`
+	if c.Value.Kind() == reflect.Map {
+		index = `.+?`
+	}
+
+	suffixes := make([]string, 0, len(templates))
+	for _, field := range templates {
+		suffix := placeholders.Replace(regexp.QuoteMeta(strings.TrimPrefix(field.Key, templatePrefix)))
+		if field.Collect {
+			suffix += "-.+"
+		}
+		suffixes = append(suffixes, suffix)
+	}
+
+	return regexp.MustCompile(fmt.Sprintf(
+		`^%s-(%s)-(?:%s)$`,
+		regexp.QuoteMeta(c.Key),
+		index,
+		strings.Join(suffixes, "|"),
+	))
+}
+
+// indices returns the element indices, or map keys, found on the source keys, sorted
+func (c *structCollection) indices(keys map[string]bool, templates []*fieldConfig) []string {
+	if len(templates) == 0 {
+		return nil
+	}
+
+	pattern := c.keyPattern(templates)
+	found := make(map[string]bool)
+	for key := range keys {
+		if match := pattern.FindStringSubmatch(key); match != nil {
+			found[match[1]] = true
+		}
+	}
+
+	indices := make([]string, 0, len(found))
+	for index := range found {
+		indices = append(indices, index)
+	}
+	sort.Strings(indices)
+	return indices
+}
+
+// expand returns the current elements of the collection and the ones for the indices found
+func (c *structCollection) expand(indices []string) ([]collectionElement, error) {
+	if c.Value.Kind() == reflect.Map {
+		return c.expandMap(indices)
+	}
+	return c.expandSlice(indices)
+}
+
+// expandSlice grows the slice with the indices found, keeping its current elements. Indices must be canonical
+// numbers and new ones must follow the current elements without gaps, so the slice grows at most by one element
+// for each index found
+func (c *structCollection) expandSlice(indices []string) ([]collectionElement, error) {
+	current := c.Value.Len()
+	found := make(map[int]bool, len(indices))
+	for _, index := range indices {
+		i, err := strconv.Atoi(index)
+		if err != nil || strconv.Itoa(i) != index {
+			return nil, &CollectionIndexError{Key: c.Key, Index: index, Reason: "must be a number without leading zeros"}
+		}
+		found[i] = true
+	}
+
+	length := current
+	for found[length] {
+		length++
+	}
+	// Any index left is after a gap, the smallest one is reported
+	gap := -1
+	for i := range found {
+		if i > length && (gap == -1 || i < gap) {
+			gap = i
+		}
+	}
+	if gap != -1 {
+		return nil, &CollectionIndexError{
+			Key:    c.Key,
+			Index:  strconv.Itoa(gap),
+			Reason: fmt.Sprintf("index %d is missing, indices must follow each other", length),
+		}
+	}
+
+	if length > current {
+		slice := reflect.MakeSlice(c.Value.Type(), length, length)
+		reflect.Copy(slice, c.Value)
+		c.Value.Set(slice)
+	}
+
+	elements := make([]collectionElement, 0, length)
+	for i := 0; i < length; i++ {
+		element := collectionElement{Index: strconv.Itoa(i), Value: c.Value.Index(i), Created: i >= current}
+		if element.Value.Kind() == reflect.Ptr {
+			if element.Value.IsNil() {
+				element.Value.Set(reflect.New(element.Value.Type().Elem()))
+				element.Created = true
+			}
+			element.Value = element.Value.Elem()
+		}
+		elements = append(elements, element)
+	}
+
+	return elements, nil
+}
+
+// expandMap adds an entry for every key found, keeping the current entries. Map values aren't addressable,
+// so struct values are filled on a copy stored back on the map, while pointers are filled in place
+func (c *structCollection) expandMap(names []string) ([]collectionElement, error) {
+	if c.Value.IsNil() {
+		c.Value.Set(reflect.MakeMap(c.Value.Type()))
+	}
+
+	entries := make(map[string]reflect.Value)
+	for _, key := range c.Value.MapKeys() {
+		entries[c.Converter.format(key)] = key
+	}
+	for _, name := range names {
+		if _, found := entries[name]; found {
+			continue
+		}
+
+		key := reflect.New(c.Value.Type().Key()).Elem()
+		if err := c.Converter.convert(name, key); err != nil {
+			var conversionError *TypeConversionError
+			if errors.As(err, &conversionError) {
+				conversionError.Key = c.Key
+			}
+			return nil, err
+		}
+		entries[name] = key
+	}
+
+	names = make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	elements := make([]collectionElement, 0, len(names))
+	for _, name := range names {
+		key := entries[name]
+		current := c.Value.MapIndex(key)
+		element := collectionElement{Index: name, Created: !current.IsValid() || current.Kind() == reflect.Ptr && current.IsNil()}
+
+		if c.Value.Type().Elem().Kind() == reflect.Ptr {
+			if element.Created {
+				current = reflect.New(c.Value.Type().Elem().Elem())
+			}
+			element.Value = current.Elem()
+			c.Value.SetMapIndex(key, current)
+		} else {
+			element.Value = reflect.New(c.Value.Type().Elem()).Elem()
+			if !element.Created {
+				element.Value.Set(current)
+			}
+
+			mapValue, value := c.Value, element.Value
+			element.Store = func() {
+				mapValue.SetMapIndex(key, value)
+			}
+			element.Store()
+		}
+
+		elements = append(elements, element)
+	}
+
+	return elements, nil
+}
+
+// expandCollections finds the elements of every collection on the sources keys, adding their fields to the struct
+// config, and returns their hooked structs. Elements may have collections of their own, expanded as well
+func (l *Loader) expandCollections(config *structConfig, envFiles []string) ([]hookedStruct, error) {
+	if len(config.Collections) == 0 {
+		return nil, nil
+	}
+
+	required := make(map[*structCollection]bool)
+	for _, collection := range config.Collections {
+		templates, err := collection.templateFields(make(map[reflect.Type]bool))
+		if err != nil {
+			return nil, err
+		}
+		config.Templates = append(config.Templates, templates...)
+		for _, template := range templates {
+			required[collection] = required[collection] || template.Required
+		}
+	}
+
+	keys, unlisted, err := l.sourceKeys(config, envFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	// Elements only set on sources that can't list their keys are never found, so their required fields are
+	// never checked either
+	for _, collection := range config.Collections {
+		if !required[collection] {
+			continue
+		}
+		for _, source := range unlisted {
+			config.Warnings = append(config.Warnings, fmt.Sprintf(
+				"elements of '%s' with required fields can't be found on source '%s', which can't list its keys",
+				collection.Key,
+				source,
+			))
+		}
+	}
+
+	var structs []hookedStruct
+	pending := config.Collections
+	for len(pending) > 0 {
+		collection := pending[0]
+		pending = pending[1:]
+
+		templates, err := collection.templateFields(make(map[reflect.Type]bool))
+		if err != nil {
+			return nil, err
+		}
+
+		elements, err := collection.expand(collection.indices(keys, templates))
+		if err != nil {
+			return nil, err
+		}
+
+		for position, element := range elements {
+			name := fmt.Sprintf("%s[%s]", collection.Name, element.Index)
+			elementStructs := hookedStructs(element.Value, name, collection.Converter)
+			if element.Created {
+				setDefaults(elementStructs)
+			}
+			// The element itself is the last one, after its nested structs
+			elementStructs[len(elementStructs)-1].Store = element.Store
+			structs = append(elementStructs, structs...)
+
+			elementConfig, err := parseStruct(element.Value, collection.elementPrefix(element.Index, position), collection.Converter)
+			if err != nil {
+				return nil, err
+			}
+			config.Fields = append(config.Fields, elementConfig.Fields...)
+			pending = append(pending, elementConfig.Collections...)
+		}
+	}
+
+	// Element fields go where their collection is on the struct, so errors and reports keep the struct order
+	sort.SliceStable(config.Fields, func(i, j int) bool {
+		return comparePositions(config.Fields[i].Position, config.Fields[j].Position) < 0
+	})
+
+	return structs, nil
+}
+
+// comparePositions returns -1, 0 or 1 if the field position a comes before, is the same or comes after b
+func comparePositions(a, b []int) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return compare(a[i] < b[i], a[i] > b[i])
+		}
+	}
+	return compare(len(a) < len(b), len(a) > len(b))
+}
+
+// sourceKeys prepares the sources only to list their keys, without loading any value. It also returns the names of
+// sources that can't list their keys, like custom sources not implementing Lister or env vars read with WithEnvLookup
+func (l *Loader) sourceKeys(config *structConfig, envFiles []string) (map[string]bool, []string, error) {
+	discovery := &structConfig{
+		Struct:      config.Struct,
+		Fields:      config.Fields,
+		Collections: config.Collections,
+		Templates:   config.Templates,
+		Discovering: true,
+	}
+
+	prepared, err := l.prepareSources(discovery, envFiles)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keys := make(map[string]bool)
+	var unlisted []string
+	for _, source := range prepared {
+		lister, ok := source.(Lister)
+		if env, isEnv := source.(*envSource); isEnv && !env.listable() {
+			ok = false
+		}
+		if _, isDefault := source.(*defaultSource); !ok && !isDefault {
+			unlisted = append(unlisted, source.Name())
+			continue
+		}
+		if ok {
+			for _, key := range lister.Keys() {
+				keys[key] = true
+			}
+		}
+	}
+
+	return keys, unlisted, nil
+}
@@ -0,0 +1,127 @@
+package openvvar
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// DecodeFunc parses a raw value into a value of the type it was registered for
+type DecodeFunc func(data string) (interface{}, error)
+
+// FormatFunc shows a value of the type it was registered for on usage messages and reports
+type FormatFunc func(value interface{}) string
+
+type decoder struct {
+	decode DecodeFunc
+	format FormatFunc
+}
+
+// decoderRegistry maps types to their decoders, safe for concurrent use
+type decoderRegistry struct {
+	mutex    sync.RWMutex
+	decoders map[reflect.Type]decoder
+}
+
+func (r *decoderRegistry) register(valueType reflect.Type, decode DecodeFunc, format FormatFunc) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.decoders == nil {
+		r.decoders = make(map[reflect.Type]decoder)
+	}
+	r.decoders[valueType] = decoder{decode: decode, format: format}
+}
+
+func (r *decoderRegistry) lookup(valueType reflect.Type) (decoder, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	d, found := r.decoders[valueType]
+	return d, found
+}
+
+var globalDecoders = &decoderRegistry{}
+
+// RegisterDecoder teaches every Loader how to parse values of a type, like types from other packages that can't
+// implement encoding.TextUnmarshaler. Format may be nil, falling back to the default formatting.
+// Decoders take precedence over built-in conversions
+func RegisterDecoder(valueType reflect.Type, decode DecodeFunc, format FormatFunc) {
+	globalDecoders.register(valueType, decode, format)
+}
+
+// WithDecoder teaches a single Loader how to parse values of a type, taking precedence over RegisterDecoder
+func WithDecoder(valueType reflect.Type, decode DecodeFunc, format FormatFunc) Option {
+	return func(l *Loader) {
+		l.decoders.register(valueType, decode, format)
+	}
+}
+
+// converter converts raw values into field values, knowing the decoders of a Loader and the field directives
+type converter struct {
+	decoders *decoderRegistry
+	// separator splits list and map elements, "," by default
+	separator string
+	// innerSeparator splits elements of nested lists, like [][]string, ";" by default
+	innerSeparator string
+	// encoding decodes []byte values, raw string bytes by default
+	encoding string
+	// valueFormat decodes the whole value at once, like "json", instead of by its type
+	valueFormat string
+	// layout parses time.Time values, RFC3339 by default, or "unix" and "unixms" for timestamps
+	layout string
+	// location is the time zone of time.Time values without one, UTC by default
+	location *time.Location
+	// unit parses integers as quantities, like "bytes" for sizes like "512KiB"
+	unit string
+	// extendedDurations parses time.Duration values with days, weeks and ISO-8601 durations
+	extendedDurations bool
+	// extendedNumbers parses integers with base prefixes, digit separators and magnitude suffixes, like "0x1F" or "10k"
+	extendedNumbers bool
+}
+
+// decoder finds the decoder for a type, on the Loader first and then globally
+func (c converter) decoder(valueType reflect.Type) (decoder, bool) {
+	if c.decoders != nil {
+		if d, found := c.decoders.lookup(valueType); found {
+			return d, true
+		}
+	}
+	return globalDecoders.lookup(valueType)
+}
+
+// isScalar tells if a type is converted as a single value, instead of by its kind, like structs or slices
+func (c converter) isScalar(valueType reflect.Type) bool {
+	_, found := c.decoder(valueType)
+	return found || isCustomType(valueType) || valueType == locationType
+}
+
+// decode sets the value using a registered decoder, returning false when there is none for its type
+func (c converter) decode(data string, value reflect.Value) (bool, error) {
+	d, found := c.decoder(value.Type())
+	if !found {
+		return false, nil
+	}
+
+	decoded, err := d.decode(data)
+	if err != nil {
+		return true, &TypeConversionError{Err: err, Value: data}
+	}
+
+	if decoded == nil {
+		value.Set(reflect.Zero(value.Type()))
+		return true, nil
+	}
+
+	decodedValue := reflect.ValueOf(decoded)
+	if !decodedValue.Type().AssignableTo(value.Type()) {
+		return true, &TypeConversionError{
+			Err:   fmt.Errorf("decoder returned %s instead of %s", decodedValue.Type(), value.Type()),
+			Value: data,
+		}
+	}
+
+	value.Set(decodedValue)
+	return true, nil
+}
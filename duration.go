@@ -0,0 +1,215 @@
+package openvvar
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const day = 24 * time.Hour
+const week = 7 * day
+
+// durationUnits maps the units of extended durations to their length, time.ParseDuration ones plus days and weeks
+var durationUnits = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"µs": time.Microsecond,
+	"μs": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  day,
+	"w":  week,
+}
+
+// isoDateUnits and isoTimeUnits are the ISO-8601 designators before and after "T", in the order they must appear.
+// Years and months have no fixed length, so they are zero and rejected
+var isoDateUnits = []time.Duration{0, 0, week, day}
+var isoTimeUnits = []time.Duration{time.Hour, time.Minute, time.Second}
+
+const isoDateDesignators = "YMWD"
+const isoTimeDesignators = "HMS"
+
+// parseDuration parses time.Duration values, with the extended syntax when enabled for the field or the Loader
+func (c converter) parseDuration(data string) (time.Duration, error) {
+	if !c.extendedDurations {
+		return time.ParseDuration(data)
+	}
+	return parseExtendedDuration(data)
+}
+
+// parseExtendedDuration parses durations like time.ParseDuration, also accepting days and weeks, like "7d" or
+// "2w3d12h", and ISO-8601 durations like "P1DT2H" or "PT30M"
+func parseExtendedDuration(data string) (time.Duration, error) {
+	text := strings.TrimSpace(data)
+
+	negative := false
+	if text != "" && (text[0] == '-' || text[0] == '+') {
+		negative = text[0] == '-'
+		text = text[1:]
+	}
+
+	var duration time.Duration
+	var err error
+	if strings.HasPrefix(text, "P") {
+		duration, err = parseISODuration(text[1:])
+	} else {
+		duration, err = parseUnitDuration(text)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("duration '%s' %w", data, err)
+	}
+
+	if negative {
+		return -duration, nil
+	}
+	return duration, nil
+}
+
+// parseUnitDuration parses a sequence of numbers followed by their units, like "1w2d" or "1.5h"
+func parseUnitDuration(text string) (time.Duration, error) {
+	if text == "0" {
+		return 0, nil
+	}
+	if text == "" {
+		return 0, fmt.Errorf("is empty")
+	}
+
+	var total time.Duration
+	for text != "" {
+		whole, fraction, rest := splitDurationNumber(text)
+		if whole == "" && fraction == "" {
+			return 0, fmt.Errorf("must have a number before each unit")
+		}
+
+		idx := strings.IndexFunc(rest, func(r rune) bool {
+			return r == '.' || r >= '0' && r <= '9'
+		})
+		if idx == -1 {
+			idx = len(rest)
+		}
+		unit, found := durationUnits[rest[:idx]]
+		if !found {
+			if rest[:idx] == "" {
+				return 0, fmt.Errorf("is missing a unit")
+			}
+			return 0, fmt.Errorf("has unknown unit '%s'", rest[:idx])
+		}
+
+		var err error
+		if total, err = addDuration(total, whole, fraction, unit); err != nil {
+			return 0, err
+		}
+		text = rest[idx:]
+	}
+
+	return total, nil
+}
+
+// parseISODuration parses an ISO-8601 duration after its "P", like "1DT2H" or "T1.5S"
+func parseISODuration(text string) (time.Duration, error) {
+	datePart, timePart, hasTime := strings.Cut(text, "T")
+	if datePart == "" && timePart == "" || hasTime && timePart == "" {
+		return 0, fmt.Errorf("must have at least one component after P or T")
+	}
+
+	dateDuration, err := parseISOComponents(datePart, isoDateDesignators, isoDateUnits)
+	if err != nil {
+		return 0, err
+	}
+	timeDuration, err := parseISOComponents(timePart, isoTimeDesignators, isoTimeUnits)
+	if err != nil {
+		return 0, err
+	}
+
+	if dateDuration > math.MaxInt64-timeDuration {
+		return 0, fmt.Errorf("overflows: %w", strconv.ErrRange)
+	}
+	return dateDuration + timeDuration, nil
+}
+
+// parseISOComponents parses numbers followed by designators, which must appear in the given order
+func parseISOComponents(text string, designators string, units []time.Duration) (time.Duration, error) {
+	var total time.Duration
+	next := 0
+	for text != "" {
+		whole, fraction, rest := splitDurationNumber(text)
+		if whole == "" && fraction == "" || rest == "" {
+			return 0, fmt.Errorf("must have a number before each designator")
+		}
+
+		idx := strings.IndexByte(designators[next:], rest[0])
+		if idx == -1 {
+			return 0, fmt.Errorf("has unexpected designator '%c'", rest[0])
+		}
+		next += idx + 1
+
+		unit := units[next-1]
+		if unit == 0 {
+			return 0, fmt.Errorf("can't have years nor months, which have no fixed length")
+		}
+
+		var err error
+		if total, err = addDuration(total, whole, fraction, unit); err != nil {
+			return 0, err
+		}
+		text = rest[1:]
+	}
+
+	return total, nil
+}
+
+// splitDurationNumber splits the digits and fraction digits at the start of text from the rest of it
+func splitDurationNumber(text string) (string, string, string) {
+	notDigit := func(r rune) bool { return r < '0' || r > '9' }
+
+	end := strings.IndexFunc(text, notDigit)
+	if end == -1 {
+		return text, "", ""
+	}
+	whole, rest := text[:end], text[end:]
+	if rest[0] != '.' {
+		return whole, "", rest
+	}
+
+	rest = rest[1:]
+	end = strings.IndexFunc(rest, notDigit)
+	if end == -1 {
+		end = len(rest)
+	}
+	return whole, rest[:end], rest[end:]
+}
+
+// addDuration adds a number of units, with optional fraction digits, to the total duration checking for overflows
+func addDuration(total time.Duration, whole string, fraction string, unit time.Duration) (time.Duration, error) {
+	overflow := fmt.Errorf("overflows: %w", strconv.ErrRange)
+
+	value := uint64(0)
+	if whole != "" {
+		parsed, err := strconv.ParseUint(whole, 10, 63)
+		if err != nil {
+			return 0, overflow
+		}
+		value = parsed
+	}
+	if value > uint64(math.MaxInt64/unit) {
+		return 0, overflow
+	}
+	duration := time.Duration(value) * unit
+
+	if fraction != "" {
+		parsed, err := strconv.ParseFloat("0."+fraction, 64)
+		if err != nil {
+			return 0, err
+		}
+		duration += time.Duration(parsed * float64(unit))
+	}
+
+	if duration < 0 || total > math.MaxInt64-duration {
+		return 0, overflow
+	}
+	return total + duration, nil
+}
@@ -1,11 +1,38 @@
 package openvvar
 
 import (
+	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
+	"sort"
 	"strings"
 )
 
+// Sentinel errors wrapped by the typed errors, to easily check which kind of failure happened with errors.Is
+var (
+	// ErrHelp is wrapped by a FlagParseError when help is requested with -h or -help flags, it also wraps flag.ErrHelp
+	ErrHelp = fmt.Errorf("openvvar: %w", flag.ErrHelp)
+	// ErrMissingRequiredField is wrapped by MissingRequiredFieldError
+	ErrMissingRequiredField = errors.New("openvvar: missing required field")
+	// ErrUnsupportedType is wrapped by InvalidTypeForDefaultValuesError
+	ErrUnsupportedType = errors.New("openvvar: unsupported field type")
+	// ErrInvalidReceiver is wrapped by InvalidReceiverError
+	ErrInvalidReceiver = errors.New("openvvar: invalid config receiver")
+	// ErrInvalidOption is wrapped by ValueNotAValidOptionError
+	ErrInvalidOption = errors.New("openvvar: value not a valid option")
+	// ErrInvalidTag is wrapped by InvalidTagError
+	ErrInvalidTag = errors.New("openvvar: invalid config tag")
+	// ErrConstraintViolation is wrapped by ConstraintViolationError
+	ErrConstraintViolation = errors.New("openvvar: constraint violation")
+	// ErrArrayLength is wrapped by ArrayLengthError
+	ErrArrayLength = errors.New("openvvar: wrong number of array elements")
+	// ErrNumberOverflow is wrapped by NumberOverflowError
+	ErrNumberOverflow = errors.New("openvvar: number overflows")
+	// ErrCollectionIndex is wrapped by CollectionIndexError
+	ErrCollectionIndex = errors.New("openvvar: invalid collection index")
+)
+
 // DotEnvNotFoundError for when the file is not found
 type DotEnvNotFoundError struct {
 	Err error
@@ -30,6 +57,8 @@ func (e *DotEnvNotFoundError) Is(target error) bool {
 }
 
 // FlagCollectionError when we receive errors from flag library
+//
+// Deprecated: Load now reports every failing field with FieldErrors
 type FlagCollectionError struct {
 	Errors map[error]bool // Using this map as a hash set
 }
@@ -39,14 +68,32 @@ func (e *FlagCollectionError) Error() string {
 	for key := range e.Errors {
 		keys = append(keys, key.Error())
 	}
+	sort.Strings(keys)
 
 	return strings.Join(keys, ": ")
 }
 
-// Is method to comply with new errors functions
+// Unwrap exposes every collected error, sorted by message. Before Go 1.20 errors.Is and errors.As don't use it,
+// so Is and As look into them too
+func (e *FlagCollectionError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for err := range e.Errors {
+		errs = append(errs, err)
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+
+	return errs
+}
+
+// Is method to comply with new errors functions, also matching any of the collected errors
 func (e *FlagCollectionError) Is(target error) bool {
 	tar, ok := target.(*FlagCollectionError)
 	if !ok {
+		for _, err := range e.Unwrap() {
+			if errors.Is(err, target) {
+				return true
+			}
+		}
 		return false
 	}
 	if tar.Errors == nil {
@@ -63,7 +110,18 @@ func (e *FlagCollectionError) Is(target error) bool {
 	return true
 }
 
-// FlagParseError is for when we fail to parse a specific flag
+// As method to comply with new errors functions, looking for the first matching collected error
+func (e *FlagCollectionError) As(target interface{}) bool {
+	for _, err := range e.Unwrap() {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FlagParseError is for when we fail to parse command line flags, like undefined flags or help requests
 type FlagParseError struct {
 	Err error
 }
@@ -72,6 +130,10 @@ func (e *FlagParseError) Error() string {
 	return e.Err.Error()
 }
 
+func (e *FlagParseError) Unwrap() error {
+	return e.Err
+}
+
 // Is method to comply with new errors functions
 func (e *FlagParseError) Is(target error) bool {
 	tar, ok := target.(*FlagParseError)
@@ -85,11 +147,32 @@ func (e *FlagParseError) Is(target error) bool {
 
 // TypeConversionError occurs on string parsing for some types
 type TypeConversionError struct {
-	Err error
+	Err    error
+	Field  string
+	Key    string
+	Source string
+	// Value is the offending raw value, a single element for lists
+	Value string
+	// Type is the type the value was converted to, like "*net.IPNet", the element type for lists
+	Type string
+	// File and Line tell where the value was defined, for sources like dot env files
+	File string
+	Line int
 }
 
 func (e *TypeConversionError) Error() string {
-	return e.Err.Error()
+	if e.Value == "" && e.File == "" {
+		return e.Err.Error()
+	}
+
+	value := fmt.Sprintf("invalid value \"%s\"", e.Value)
+	if e.Type != "" {
+		value = fmt.Sprintf("%s for %s", value, e.Type)
+	}
+	if e.File != "" {
+		return fmt.Sprintf("%s at %s:%d: %v", value, e.File, e.Line, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", value, e.Err)
 }
 
 func (e *TypeConversionError) Unwrap() error {
@@ -103,7 +186,11 @@ func (e *TypeConversionError) Is(target error) bool {
 		return false
 	}
 
-	return errors.Is(e.Err, tar.Err) || tar.Err == nil
+	return (errors.Is(e.Err, tar.Err) || tar.Err == nil) &&
+		(e.Field == tar.Field || tar.Field == "") &&
+		(e.Key == tar.Key || tar.Key == "") &&
+		(e.Source == tar.Source || tar.Source == "") &&
+		(e.Type == tar.Type || tar.Type == "")
 }
 
 // MissingRequiredFieldError when user forgets to fill a required config
@@ -116,6 +203,10 @@ func (e *MissingRequiredFieldError) Error() string {
 	return fmt.Sprintf("required key '%s' for field '%s' not found", e.Key, e.Field)
 }
 
+func (e *MissingRequiredFieldError) Unwrap() error {
+	return ErrMissingRequiredField
+}
+
 // Is method to comply with new errors functions
 func (e *MissingRequiredFieldError) Is(target error) bool {
 	tar, ok := target.(*MissingRequiredFieldError)
@@ -128,13 +219,21 @@ func (e *MissingRequiredFieldError) Is(target error) bool {
 
 // InvalidTypeForDefaultValuesError when developer puts a bogus default value for some type
 type InvalidTypeForDefaultValuesError struct {
-	Type string
+	Type   string
+	Field  string
+	Key    string
+	Source string
+	Value  string
 }
 
 func (e *InvalidTypeForDefaultValuesError) Error() string {
 	return fmt.Sprintf("field type '%s' not supported", e.Type)
 }
 
+func (e *InvalidTypeForDefaultValuesError) Unwrap() error {
+	return ErrUnsupportedType
+}
+
 // Is method to comply with new errors functions
 func (e *InvalidTypeForDefaultValuesError) Is(target error) bool {
 	tar, ok := target.(*InvalidTypeForDefaultValuesError)
@@ -142,7 +241,7 @@ func (e *InvalidTypeForDefaultValuesError) Is(target error) bool {
 		return false
 	}
 
-	return e.Type == tar.Type || tar.Type == ""
+	return (e.Type == tar.Type || tar.Type == "") && (e.Field == tar.Field || tar.Field == "")
 }
 
 // InvalidReceiverError when developer pass something that isn't a point to struct to receive configs
@@ -152,6 +251,10 @@ func (e *InvalidReceiverError) Error() string {
 	return "provided config receiver must be a pointer to struct"
 }
 
+func (e *InvalidReceiverError) Unwrap() error {
+	return ErrInvalidReceiver
+}
+
 // Is method to comply with new errors functions
 func (e *InvalidReceiverError) Is(target error) bool {
 	_, ok := target.(*InvalidReceiverError)
@@ -162,6 +265,9 @@ func (e *InvalidReceiverError) Is(target error) bool {
 type ValueNotAValidOptionError struct {
 	Value   string
 	Options map[string]bool
+	Field   string
+	Key     string
+	Source  string
 }
 
 func (e *ValueNotAValidOptionError) Error() string {
@@ -169,9 +275,14 @@ func (e *ValueNotAValidOptionError) Error() string {
 	for option := range e.Options {
 		options = append(options, option)
 	}
+	sort.Strings(options)
 	return fmt.Sprintf("received value \"%s\" is not a valid option from %v", e.Value, options)
 }
 
+func (e *ValueNotAValidOptionError) Unwrap() error {
+	return ErrInvalidOption
+}
+
 // Is method to comply with new errors functions
 func (e *ValueNotAValidOptionError) Is(target error) bool {
 	tar, ok := target.(*ValueNotAValidOptionError)
@@ -191,3 +302,288 @@ func (e *ValueNotAValidOptionError) Is(target error) bool {
 
 	return true
 }
+
+// ConstraintViolationError for when a value doesn't satisfy a validation directive, like min or pattern
+type ConstraintViolationError struct {
+	Constraint string
+	Reason     string
+	Value      string
+	Field      string
+	Key        string
+	Source     string
+}
+
+func (e *ConstraintViolationError) Error() string {
+	return fmt.Sprintf("value \"%s\" violates '%s': %s", e.Value, e.Constraint, e.Reason)
+}
+
+func (e *ConstraintViolationError) Unwrap() error {
+	return ErrConstraintViolation
+}
+
+// Is method to comply with new errors functions
+func (e *ConstraintViolationError) Is(target error) bool {
+	tar, ok := target.(*ConstraintViolationError)
+	if !ok {
+		return false
+	}
+
+	return (e.Constraint == tar.Constraint || tar.Constraint == "") && (e.Key == tar.Key || tar.Key == "")
+}
+
+// InvalidTagError for when developer writes a malformed config tag, like unknown or duplicated directives
+type InvalidTagError struct {
+	Field     string
+	Tag       string
+	Directive string
+	Reason    string
+}
+
+func (e *InvalidTagError) Error() string {
+	if e.Directive == "" {
+		return fmt.Sprintf("invalid config tag on field '%s': %s", e.Field, e.Reason)
+	}
+	return fmt.Sprintf("invalid config tag on field '%s': %s '%s'", e.Field, e.Reason, e.Directive)
+}
+
+func (e *InvalidTagError) Unwrap() error {
+	return ErrInvalidTag
+}
+
+// Is method to comply with new errors functions
+func (e *InvalidTagError) Is(target error) bool {
+	tar, ok := target.(*InvalidTagError)
+	if !ok {
+		return false
+	}
+
+	return (e.Field == tar.Field || tar.Field == "") && (e.Directive == tar.Directive || tar.Directive == "")
+}
+
+// HookError for when a Finalize or Validate method of a config struct fails
+type HookError struct {
+	Hook   string
+	Struct string
+	Err    error
+}
+
+func (e *HookError) Error() string {
+	return fmt.Sprintf("%s on '%s': %v", e.Hook, e.Struct, e.Err)
+}
+
+func (e *HookError) Unwrap() error {
+	return e.Err
+}
+
+// Is method to comply with new errors functions
+func (e *HookError) Is(target error) bool {
+	tar, ok := target.(*HookError)
+	if !ok {
+		return false
+	}
+
+	return (e.Hook == tar.Hook || tar.Hook == "") && (e.Struct == tar.Struct || tar.Struct == "")
+}
+
+// ArrayLengthError for when a value for an array field doesn't have exactly as many elements as the array,
+// wrapped by a TypeConversionError
+type ArrayLengthError struct {
+	Expected int
+	Actual   int
+}
+
+func (e *ArrayLengthError) Error() string {
+	return fmt.Sprintf("expected %d elements, got %d", e.Expected, e.Actual)
+}
+
+func (e *ArrayLengthError) Unwrap() error {
+	return ErrArrayLength
+}
+
+// Is method to comply with new errors functions
+func (e *ArrayLengthError) Is(target error) bool {
+	tar, ok := target.(*ArrayLengthError)
+	if !ok {
+		return false
+	}
+
+	return (e.Expected == tar.Expected || tar.Expected == 0) && (e.Actual == tar.Actual || tar.Actual == 0)
+}
+
+// NumberOverflowError for when an extended integer doesn't fit the bits of its field, wrapped by a TypeConversionError
+type NumberOverflowError struct {
+	Value string
+	Bits  int
+}
+
+func (e *NumberOverflowError) Error() string {
+	return fmt.Sprintf("'%s' overflows %d bits", e.Value, e.Bits)
+}
+
+func (e *NumberOverflowError) Unwrap() error {
+	return ErrNumberOverflow
+}
+
+// Is method to comply with new errors functions
+func (e *NumberOverflowError) Is(target error) bool {
+	tar, ok := target.(*NumberOverflowError)
+	if !ok {
+		return false
+	}
+
+	return (e.Value == tar.Value || tar.Value == "") && (e.Bits == tar.Bits || tar.Bits == 0)
+}
+
+// CollectionIndexError for when the indices of a slice of structs found on the sources aren't canonical numbers,
+// like "01", or leave gaps, like UPSTREAMS_2_HOST without UPSTREAMS_1_HOST
+type CollectionIndexError struct {
+	Key    string
+	Index  string
+	Reason string
+}
+
+func (e *CollectionIndexError) Error() string {
+	return fmt.Sprintf("invalid index '%s' for '%s': %s", e.Index, e.Key, e.Reason)
+}
+
+func (e *CollectionIndexError) Unwrap() error {
+	return ErrCollectionIndex
+}
+
+// Is method to comply with new errors functions
+func (e *CollectionIndexError) Is(target error) bool {
+	tar, ok := target.(*CollectionIndexError)
+	if !ok {
+		return false
+	}
+
+	return (e.Key == tar.Key || tar.Key == "") && (e.Index == tar.Index || tar.Index == "")
+}
+
+// FieldError is a failure on a single field, telling where the failing value came from
+type FieldError struct {
+	Field  string
+	Key    string
+	EnvVar string
+	Source string // Empty when no source had a value for the field
+	Err    error
+}
+
+func newFieldError(field *fieldConfig, source string, err error) *FieldError {
+	return &FieldError{
+		Field:  field.Name,
+		Key:    field.Key,
+		EnvVar: envVarName(field.Key),
+		Source: source,
+		Err:    err,
+	}
+}
+
+// addContext fills field, key, source and value information on the typed errors that carry it
+func addContext(err error, field *fieldConfig, source string, data string) error {
+	var conversionError *TypeConversionError
+	if errors.As(err, &conversionError) {
+		conversionError.Field, conversionError.Key, conversionError.Source = field.Name, field.Key, source
+		if conversionError.Value == "" {
+			conversionError.Value = data
+		}
+	}
+
+	var invalidTypeError *InvalidTypeForDefaultValuesError
+	if errors.As(err, &invalidTypeError) {
+		invalidTypeError.Field, invalidTypeError.Key, invalidTypeError.Source = field.Name, field.Key, source
+		invalidTypeError.Value = data
+	}
+
+	return err
+}
+
+func (e *FieldError) Error() string {
+	if e.Source == "" {
+		return fmt.Sprintf("field '%s' (%s): %v", e.Field, e.EnvVar, e.Err)
+	}
+	return fmt.Sprintf("field '%s' (%s) from %s: %v", e.Field, e.EnvVar, e.Source, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// Is method to comply with new errors functions
+func (e *FieldError) Is(target error) bool {
+	tar, ok := target.(*FieldError)
+	if !ok {
+		return false
+	}
+
+	return (e.Field == tar.Field || tar.Field == "") && (e.Key == tar.Key || tar.Key == "")
+}
+
+// MarshalJSON renders the error with its reason as a string
+func (e *FieldError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Field  string `json:"field"`
+		Key    string `json:"key"`
+		EnvVar string `json:"env"`
+		Source string `json:"source,omitempty"`
+		Reason string `json:"reason"`
+	}{e.Field, e.Key, e.EnvVar, e.Source, e.Err.Error()})
+}
+
+// FieldErrors aggregates every field failure found on a single Load, in struct order
+type FieldErrors struct {
+	Errors []*FieldError
+}
+
+func (e *FieldErrors) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		messages = append(messages, err.Error())
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+// Unwrap exposes every field error to errors.Is and errors.As
+func (e *FieldErrors) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// Is method to comply with new errors functions, matching any of the field errors
+func (e *FieldErrors) Is(target error) bool {
+	if _, ok := target.(*FieldErrors); ok {
+		return true
+	}
+
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// As method to comply with new errors functions, looking for the first matching field error
+func (e *FieldErrors) As(target interface{}) bool {
+	for _, err := range e.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MarshalJSON renders the errors as a JSON list
+func (e *FieldErrors) MarshalJSON() ([]byte, error) {
+	if e.Errors == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(e.Errors)
+}
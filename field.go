@@ -1,8 +1,13 @@
 package openvvar
 
 import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -16,32 +21,414 @@ type fieldConfig struct {
 	Description string
 	Value       reflect.Value
 	Default     reflect.Value
+	DefaultRaw  string
+	HasDefault  bool
 	Options     map[string]bool
 	Required    bool
+	// OptionValues holds options converted to the field type, or to the element type for slices
+	OptionValues []reflect.Value
+	// Aliases maps alternative spellings to canonical string values, like "pg" to "postgresql"
+	Aliases map[string]string
+	// IgnoreCase makes options and aliases match string values regardless of case
+	IgnoreCase bool
+	// Constraints are validation directives like min, max or pattern
+	Constraints []constraint
+	// Provided holds the values given by sources for this field, from the lowest to the highest priority
+	Provided []SourceValue
+	// Errors holds failures from this field values, on sources or on validation
+	Errors []*FieldError
+	// Converter converts raw values into the field value
+	Converter converter
+	// Collect fills a map field with every key under the field key, like LABELS_TEAM and LABELS_TIER for "labels"
+	Collect bool
+	// Position is the path of field indices, and element positions, from the receiver to the field, so fields
+	// of collection elements are sorted where their collection is on the struct
+	Position []int
 }
 
 var durationType = reflect.TypeOf(time.Duration(0))
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+var flagValueType = reflect.TypeOf((*flag.Value)(nil)).Elem()
 
-// Set and String so fieldConfig complain with flag.Value
-func (f *fieldConfig) Set(data string) error {
-	return convert(data, f.Value)
+// isCustomType tells if a type, or a pointer to it, knows how to parse itself with
+// encoding.TextUnmarshaler or flag.Value, so it's handled as a single value instead of a struct or slice
+func isCustomType(valueType reflect.Type) bool {
+	if valueType.Kind() != reflect.Ptr {
+		valueType = reflect.PtrTo(valueType)
+	}
+	return valueType.Implements(textUnmarshalerType) || valueType.Implements(flagValueType)
+}
+
+// isList tells if a type is parsed as a list of elements, like slices and arrays, but not []byte
+func (c converter) isList(valueType reflect.Type) bool {
+	kind := valueType.Kind()
+	return (kind == reflect.Slice || kind == reflect.Array) && !c.isScalar(valueType) && !isBytes(valueType)
+}
+
+// isBytes tells if a type is a []byte, decoded as a single value instead of a list of numbers
+func isBytes(valueType reflect.Type) bool {
+	return valueType.Kind() == reflect.Slice && valueType.Elem().Kind() == reflect.Uint8
+}
+
+// hasLength tells if a type has elements to be counted by length constraints, besides strings
+func (c converter) hasLength(valueType reflect.Type) bool {
+	return c.isList(valueType) || c.isMap(valueType) || isBytes(valueType) && !c.isScalar(valueType)
+}
+
+// isMap tells if a type is parsed as key=value entries
+func (c converter) isMap(valueType reflect.Type) bool {
+	return valueType.Kind() == reflect.Map && !c.isScalar(valueType)
+}
+
+// indirectType returns the type pointer fields point to, like int for *int, unless a decoder handles the pointer
+func (c converter) indirectType(valueType reflect.Type) reflect.Type {
+	for valueType.Kind() == reflect.Ptr {
+		if _, found := c.decoder(valueType); found {
+			break
+		}
+		valueType = valueType.Elem()
+	}
+	return valueType
 }
 
+// format shows a value on usage messages and reports, using a registered format function,
+// or encoding.TextMarshaler or fmt.Stringer when the value, or a pointer to it, implements them.
+// Nil pointers are shown as an empty string
+func (c converter) format(value reflect.Value) string {
+	d, found := c.decoder(value.Type())
+	if found && d.format != nil {
+		return d.format(value.Interface())
+	}
+
+	if c.valueFormat == "json" {
+		if value.IsZero() {
+			return ""
+		}
+		if encoded, err := json.Marshal(value.Interface()); err == nil {
+			return string(encoded)
+		}
+	}
+
+	if value.Kind() == reflect.Ptr && !found {
+		if value.IsNil() {
+			return ""
+		}
+		return c.format(value.Elem())
+	}
+
+	if isBytes(value.Type()) && !c.isScalar(value.Type()) {
+		return c.encodeBytes(value.Bytes())
+	}
+
+	if value.Type() == timeType {
+		return c.formatTime(value.Interface().(time.Time))
+	}
+
+	if c.unit == bytesUnit && !c.isScalar(value.Type()) {
+		switch value.Kind() {
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return ByteSize(value.Uint()).String()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if value.Int() >= 0 {
+				return ByteSize(value.Int()).String()
+			}
+		}
+	}
+
+	if c.isList(value.Type()) && (c.isScalar(value.Type().Elem()) || c.unit == bytesUnit) {
+		elements := make([]string, 0, value.Len())
+		for i := 0; i < value.Len(); i++ {
+			elements = append(elements, c.format(value.Index(i)))
+		}
+		return fmt.Sprintf("[%s]", strings.Join(elements, " "))
+	}
+
+	formatted := value
+	if value.CanAddr() && value.Kind() != reflect.Ptr {
+		formatted = value.Addr()
+	}
+
+	if formatted.Kind() != reflect.Ptr || !formatted.IsNil() {
+		switch v := formatted.Interface().(type) {
+		case encoding.TextMarshaler:
+			if text, err := v.MarshalText(); err == nil {
+				return string(text)
+			}
+		case fmt.Stringer:
+			return v.String()
+		}
+	}
+
+	return fmt.Sprintf("%v", value)
+}
+
+// String shows the field default value on usage messages
 func (f *fieldConfig) String() string {
 	if f.Required && f.Default.IsZero() {
 		return ""
 	}
-	return fmt.Sprintf("%v", f.Default)
+	return f.Converter.format(f.Default)
+}
+
+// validate checks the loaded value for required, options and constraint directives, recording failures on field errors.
+// Required fields must be provided by any source, even with a zero value like 0 or false
+func (f *fieldConfig) validate() {
+	if f.Required && len(f.Provided) == 0 {
+		f.Errors = append(f.Errors, newFieldError(f, "", &MissingRequiredFieldError{Key: f.Key, Field: f.Name}))
+		return
+	}
+
+	elements := f.elements()
+	for _, value := range elements {
+		f.normalize(value)
+
+		if f.OptionValues != nil && !f.isOption(value) {
+			f.Errors = append(f.Errors, newFieldError(f, f.source(), &ValueNotAValidOptionError{
+				Value:   f.Converter.format(value),
+				Options: f.Options,
+				Field:   f.Name,
+				Key:     f.Key,
+				Source:  f.source(),
+			}))
+		}
+	}
+
+	// Map values aren't addressable, so normalized copies are set back
+	if value, ok := f.indirect(); ok && f.Converter.isMap(value.Type()) {
+		for i, key := range mapKeys(value, f.Converter) {
+			value.SetMapIndex(key, elements[i])
+		}
+	}
+	f.checkConstraints()
+}
+
+// parseOptions converts every option to the type of the field, or of its elements for slices
+func (f *fieldConfig) parseOptions() error {
+	if f.Options == nil {
+		return nil
+	}
+
+	optionType := f.elementType()
+
+	options := make([]string, 0, len(f.Options))
+	for option := range f.Options {
+		options = append(options, option)
+	}
+	sort.Strings(options)
+
+	f.OptionValues = make([]reflect.Value, 0, len(options))
+	for _, option := range options {
+		optionValue := reflect.New(optionType).Elem()
+		if err := f.elementConverter().convert(option, optionValue); err != nil {
+			return addContext(err, f, "options", option)
+		}
+		f.OptionValues = append(f.OptionValues, optionValue)
+	}
+
+	return nil
+}
+
+// elementType returns the type of the field, or of its elements for slices and maps, following pointers
+func (f *fieldConfig) elementType() reflect.Type {
+	valueType := f.Converter.indirectType(f.Value.Type())
+	if f.Converter.isList(valueType) || f.Converter.isMap(valueType) {
+		return valueType.Elem()
+	}
+	return valueType
 }
 
-func convert(data string, value reflect.Value) error {
+// elementConverter converts values of the element type, like options and bounds
+func (f *fieldConfig) elementConverter() converter {
+	if f.elementType() == f.Value.Type() {
+		return f.Converter
+	}
+	return f.Converter.elementConverter()
+}
+
+// indirect returns the value pointer fields point to, and false when it's nil
+func (f *fieldConfig) indirect() (reflect.Value, bool) {
+	value := f.Value
+	for value.Kind() == reflect.Ptr {
+		if _, found := f.Converter.decoder(value.Type()); found {
+			break
+		}
+		if value.IsNil() {
+			return reflect.Value{}, false
+		}
+		value = value.Elem()
+	}
+	return value, true
+}
+
+// elements returns the values to be checked against options, each element for slices
+// and a copy of each value for maps, sorted by key. Nil pointers have no elements
+func (f *fieldConfig) elements() []reflect.Value {
+	value, ok := f.indirect()
+	if !ok {
+		return nil
+	}
+
+	if f.Converter.isMap(value.Type()) {
+		keys := mapKeys(value, f.Converter)
+		elements := make([]reflect.Value, 0, len(keys))
+		for _, key := range keys {
+			element := reflect.New(value.Type().Elem()).Elem()
+			element.Set(value.MapIndex(key))
+			elements = append(elements, element)
+		}
+		return elements
+	}
+
+	if !f.Converter.isList(value.Type()) {
+		return []reflect.Value{value}
+	}
+
+	elements := make([]reflect.Value, 0, value.Len())
+	for i := 0; i < value.Len(); i++ {
+		elements = append(elements, value.Index(i))
+	}
+	return elements
+}
+
+// mapKeys returns the keys of a map sorted by their formatted value
+func mapKeys(value reflect.Value, c converter) []reflect.Value {
+	keys := value.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return c.format(keys[i]) < c.format(keys[j])
+	})
+	return keys
+}
+
+// normalize replaces aliases and, when ignoring case, different spellings of options by their canonical value
+func (f *fieldConfig) normalize(value reflect.Value) {
+	if value.Kind() != reflect.String {
+		return
+	}
+
+	for alias, canonical := range f.Aliases {
+		if value.String() == alias || f.IgnoreCase && strings.EqualFold(value.String(), alias) {
+			value.SetString(canonical)
+			break
+		}
+	}
+
+	if f.IgnoreCase {
+		for _, option := range f.OptionValues {
+			if strings.EqualFold(value.String(), option.String()) {
+				value.SetString(option.String())
+				break
+			}
+		}
+	}
+}
+
+func (f *fieldConfig) isOption(value reflect.Value) bool {
+	for _, option := range f.OptionValues {
+		if reflect.DeepEqual(value.Interface(), option.Interface()) {
+			return true
+		}
+	}
+	return false
+}
+
+// source returns the name of the source that set the field value, if any
+func (f *fieldConfig) source() string {
+	if len(f.Provided) == 0 {
+		return ""
+	}
+	return f.Provided[len(f.Provided)-1].Source
+}
+
+// convert parses raw data into the value, telling the type on conversion errors
+func (c converter) convert(data string, value reflect.Value) error {
+	err := c.convertValue(data, value)
+
+	var conversionError *TypeConversionError
+	if errors.As(err, &conversionError) && conversionError.Type == "" {
+		conversionError.Type = value.Type().String()
+	}
+	return err
+}
+
+func (c converter) convertValue(data string, value reflect.Value) error {
 	valueType := value.Type()
 
+	// Formats like JSON decode the whole value at once, replacing the current one
+	if c.valueFormat == "json" {
+		decoded := reflect.New(valueType)
+		if err := json.Unmarshal([]byte(data), decoded.Interface()); err != nil {
+			return &TypeConversionError{Err: err, Value: data}
+		}
+		value.Set(decoded.Elem())
+		return nil
+	}
+
+	// Registered decoders take precedence over everything else
+	if decoded, err := c.decode(data, value); decoded {
+		return err
+	}
+
+	// Time zones are pointers, but parsed as a whole from their IANA name
+	if valueType == locationType {
+		location, err := time.LoadLocation(data)
+		if err != nil {
+			return &TypeConversionError{Err: err, Value: data}
+		}
+		value.Set(reflect.ValueOf(location))
+		return nil
+	}
+
+	// Pointers are allocated only when there is a value for them, so unset fields stay nil
+	if valueType.Kind() == reflect.Ptr {
+		pointed := reflect.New(valueType.Elem())
+		if err := c.convert(data, pointed.Elem()); err != nil {
+			return err
+		}
+		value.Set(pointed)
+		return nil
+	}
+
+	// Time implements encoding.TextUnmarshaler, but only for RFC3339
+	if valueType == timeType {
+		parsed, err := c.parseTime(data)
+		if err != nil {
+			return &TypeConversionError{Err: err, Value: data}
+		}
+		value.Set(reflect.ValueOf(parsed))
+		return nil
+	}
+
+	// Types that know how to parse themselves take precedence over their kind
+	if value.CanAddr() {
+		switch custom := value.Addr().Interface().(type) {
+		case encoding.TextUnmarshaler:
+			if err := custom.UnmarshalText([]byte(data)); err != nil {
+				return &TypeConversionError{Err: err, Value: data}
+			}
+			return nil
+		case flag.Value:
+			if err := custom.Set(data); err != nil {
+				return &TypeConversionError{Err: err, Value: data}
+			}
+			return nil
+		}
+	}
+
+	// Bytes are a single value, not a list of numbers
+	if isBytes(valueType) {
+		decoded, err := c.decodeBytes(data)
+		if err != nil {
+			return &TypeConversionError{Err: err, Value: data}
+		}
+		value.SetBytes(decoded)
+		return nil
+	}
+
 	// Duration is a special type because we need to reflect on an instance of it
 	if valueType == durationType {
-		d, err := time.ParseDuration(data)
+		d, err := c.parseDuration(data)
 		if err != nil {
-			return &TypeConversionError{err}
+			return &TypeConversionError{Err: err, Value: data}
 		}
 		value.SetInt(int64(d))
 	} else {
@@ -49,18 +436,21 @@ func convert(data string, value reflect.Value) error {
 		case reflect.Bool:
 			b, err := strconv.ParseBool(data)
 			if err != nil {
-				return &TypeConversionError{err}
+				return &TypeConversionError{Err: err, Value: data}
 			}
 			value.SetBool(b)
 		case reflect.Slice:
+			splattedStrings, err := splitList(data, c.listSeparator())
+			if err != nil {
+				return &TypeConversionError{Err: err, Value: data}
+			}
 			// create a new temporary slice to override the actual Value if it's not empty
-			splattedStrings := strings.Split(data, ",")
 			newSlice := reflect.MakeSlice(value.Type(), 0, len(splattedStrings))
 			for _, str := range splattedStrings {
 				// create a new Value v based on the type of the slice
 				currentValue := reflect.Indirect(reflect.New(valueType.Elem()))
 				// call convert to set the current value of the slice to v
-				if err := convert(str, currentValue); err != nil {
+				if err := c.elementConverter().convert(str, currentValue); err != nil {
 					return err // This one is an error of a recursive call
 				}
 				// append v to the temporary slice
@@ -68,6 +458,45 @@ func convert(data string, value reflect.Value) error {
 			}
 			// Set the newly created temporary slice to the target Value
 			value.Set(newSlice)
+		case reflect.Array:
+			// Arrays are parsed like slices, but must have exactly their length of elements
+			splattedStrings, err := splitList(data, c.listSeparator())
+			if err != nil {
+				return &TypeConversionError{Err: err, Value: data}
+			}
+			if len(splattedStrings) != valueType.Len() {
+				return &TypeConversionError{
+					Err:   &ArrayLengthError{Expected: valueType.Len(), Actual: len(splattedStrings)},
+					Value: data,
+				}
+			}
+			newArray := reflect.New(valueType).Elem()
+			for i, str := range splattedStrings {
+				if err := c.elementConverter().convert(str, newArray.Index(i)); err != nil {
+					return err
+				}
+			}
+			value.Set(newArray)
+		case reflect.Map:
+			entries, err := splitList(data, c.listSeparator())
+			if err != nil {
+				return &TypeConversionError{Err: err, Value: data}
+			}
+			// Like slices, a new map overrides the actual Value
+			newMap := reflect.MakeMap(valueType)
+			for _, entry := range entries {
+				idx := strings.Index(entry, "=")
+				if idx == -1 {
+					return &TypeConversionError{
+						Err:   fmt.Errorf("map entry '%s' must be written as key=value", entry),
+						Value: data,
+					}
+				}
+				if err := c.setMapEntry(entry[:idx], entry[idx+1:], newMap); err != nil {
+					return err
+				}
+			}
+			value.Set(newMap)
 		case reflect.String:
 			value.SetString(data)
 		case reflect.Int,
@@ -75,9 +504,9 @@ func convert(data string, value reflect.Value) error {
 			reflect.Int16,
 			reflect.Int32,
 			reflect.Int64:
-			parsedInt, err := strconv.ParseInt(data, 10, valueType.Bits())
+			parsedInt, err := c.parseInt(data, valueType)
 			if err != nil {
-				return &TypeConversionError{err}
+				return &TypeConversionError{Err: err, Value: data}
 			}
 
 			value.SetInt(parsedInt)
@@ -86,22 +515,105 @@ func convert(data string, value reflect.Value) error {
 			reflect.Uint16,
 			reflect.Uint32,
 			reflect.Uint64:
-			parsedUint, err := strconv.ParseUint(data, 10, valueType.Bits())
+			parsedUint, err := c.parseUint(data, valueType)
 			if err != nil {
-				return &TypeConversionError{err}
+				return &TypeConversionError{Err: err, Value: data}
 			}
 
 			value.SetUint(parsedUint)
 		case reflect.Float32, reflect.Float64:
 			parsedFloat, err := strconv.ParseFloat(data, valueType.Bits())
 			if err != nil {
-				return &TypeConversionError{err}
+				return &TypeConversionError{Err: err, Value: data}
 			}
 			value.SetFloat(parsedFloat)
 		default:
-			return &InvalidTypeForDefaultValuesError{valueType.Kind().String()}
+			return &InvalidTypeForDefaultValuesError{Type: valueType.Kind().String()}
 		}
 	}
 
 	return nil
 }
+
+// setMapEntry converts a key and its value to the map key and element types, setting them on the map
+func (c converter) setMapEntry(key string, data string, mapValue reflect.Value) error {
+	keyValue := reflect.New(mapValue.Type().Key()).Elem()
+	if err := c.convert(key, keyValue); err != nil {
+		return err
+	}
+
+	element := reflect.New(mapValue.Type().Elem()).Elem()
+	if err := c.elementConverter().convert(data, element); err != nil {
+		return err
+	}
+
+	mapValue.SetMapIndex(keyValue, element)
+	return nil
+}
+
+func (c converter) listSeparator() string {
+	if c.separator == "" {
+		return ","
+	}
+	return c.separator
+}
+
+// elementConverter converts elements of lists and maps, splitting nested lists on the inner separator
+func (c converter) elementConverter() converter {
+	inner := c
+	inner.separator = c.innerSeparator
+	if inner.separator == "" {
+		inner.separator = ";"
+	}
+	inner.innerSeparator = ""
+	inner.valueFormat = ""
+	return inner
+}
+
+// splitList splits a list value on the separator like a CSV record: elements starting with a double quote may have
+// the separator inside, with two double quotes for a literal one. Empty values have no elements
+func splitList(data string, separator string) ([]string, error) {
+	elements := []string{}
+	if data == "" {
+		return elements, nil
+	}
+
+	var builder strings.Builder
+	rest := data
+	for {
+		if strings.HasPrefix(rest, `"`) {
+			rest = rest[1:]
+			for {
+				idx := strings.Index(rest, `"`)
+				if idx == -1 {
+					return nil, fmt.Errorf("unterminated quoted element")
+				}
+				builder.WriteString(rest[:idx])
+				rest = rest[idx+1:]
+
+				// Two double quotes are a literal one, otherwise the quoted element is over
+				if !strings.HasPrefix(rest, `"`) {
+					break
+				}
+				builder.WriteByte('"')
+				rest = rest[1:]
+			}
+			if rest != "" && !strings.HasPrefix(rest, separator) {
+				return nil, fmt.Errorf("quoted element must be followed by the separator '%s'", separator)
+			}
+		} else if idx := strings.Index(rest, separator); idx != -1 {
+			builder.WriteString(rest[:idx])
+			rest = rest[idx:]
+		} else {
+			builder.WriteString(rest)
+			rest = ""
+		}
+
+		elements = append(elements, builder.String())
+		builder.Reset()
+		if rest == "" {
+			return elements, nil
+		}
+		rest = rest[len(separator):]
+	}
+}
@@ -0,0 +1,100 @@
+package openvvar
+
+import (
+	"reflect"
+)
+
+// Defaulter is implemented by config structs that set their own defaults, called before querying any source.
+// Defaults from "default=" directives override the ones set here.
+type Defaulter interface {
+	SetDefaults()
+}
+
+// Finalizer is implemented by config structs that compute derived fields, like a DSN built from host and port,
+// called after all sources are loaded and validated
+type Finalizer interface {
+	Finalize() error
+}
+
+// Validator is implemented by config structs with cross field rules, called after Finalize
+type Validator interface {
+	Validate() error
+}
+
+// hookedStruct is the receiver or a nested struct, which may implement the lifecycle hooks
+type hookedStruct struct {
+	Name  string
+	Value reflect.Value
+	// Store sets a map element back on its map after it changes, nil for other structs
+	Store func()
+}
+
+// hookedStructs lists the receiver and all its nested structs bottom-up, nested structs before their parents.
+// Structs decoded at once, like the ones with "format=json", are single values without hooks
+func hookedStructs(receiverStruct reflect.Value, name string, conv converter) []hookedStruct {
+	var structs []hookedStruct
+
+	receiverStructType := receiverStruct.Type()
+	for i := 0; i < receiverStruct.NumField(); i++ {
+		field := receiverStructType.Field(i)
+		// Invalid tags are reported when the struct is parsed
+		if formatted, _ := hasFormat(field.Tag.Get("config")); field.PkgPath != "" || formatted {
+			continue
+		}
+
+		if nested, ok := conv.nestedStruct(receiverStruct.Field(i)); ok {
+			structs = append(structs, hookedStructs(nested, name+"."+field.Name, conv)...)
+		}
+	}
+
+	return append(structs, hookedStruct{Name: name, Value: receiverStruct})
+}
+
+// hook returns the struct as an interface so hooks with pointer receivers are found
+func (s hookedStruct) hook() interface{} {
+	if s.Value.CanAddr() {
+		return s.Value.Addr().Interface()
+	}
+	return s.Value.Interface()
+}
+
+func setDefaults(structs []hookedStruct) {
+	for _, s := range structs {
+		if defaulter, ok := s.hook().(Defaulter); ok {
+			defaulter.SetDefaults()
+		}
+	}
+}
+
+// storeElements sets map elements back on their maps, so their parents see the loaded values
+func storeElements(structs []hookedStruct) {
+	for _, s := range structs {
+		if s.Store != nil {
+			s.Store()
+		}
+	}
+}
+
+// finalizeAndValidate calls Finalize on every struct and then Validate on every struct, stopping on first error
+func finalizeAndValidate(structs []hookedStruct) error {
+	for _, s := range structs {
+		if finalizer, ok := s.hook().(Finalizer); ok {
+			if err := finalizer.Finalize(); err != nil {
+				return &HookError{Hook: "Finalize", Struct: s.Name, Err: err}
+			}
+		}
+		if s.Store != nil {
+			s.Store()
+		}
+	}
+
+	for _, s := range structs {
+		if validator, ok := s.hook().(Validator); ok {
+			if err := validator.Validate(); err != nil {
+				return &HookError{Hook: "Validate", Struct: s.Name, Err: err}
+			}
+		}
+	}
+
+	return nil
+}
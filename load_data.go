@@ -1,54 +1,131 @@
 package openvvar
 
 import (
-	"flag"
+	"errors"
 	"fmt"
-	"os"
+	"reflect"
+	"sort"
 	"strings"
 )
 
-// loadStructData takes a struct config, define flags based on it and parse the command line args.
-func loadStructData(config *structConfig) error {
+// loadStructData takes a struct config, prepares every source and sets each field with the values found on them,
+// from the lowest to the highest priority source. Values that fail to convert are recorded on the field errors.
+func (l *Loader) loadStructData(config *structConfig, envFiles []string) error {
 
-	commandLine := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	prepared, err := l.prepareSources(config, envFiles)
+	if err != nil {
+		return err
+	}
 
 	for _, field := range config.Fields {
-		field.Value.Set(field.Default)
-		commandLine.Var(field, field.Key, field.Description)
-		if field.Short != "" {
-			commandLine.Var(field, field.Short, shortDesc(field.Description))
+		for _, source := range prepared {
+			if data, found := source.Lookup(field.Key); found {
+				if err := field.Converter.convert(data, field.Value); err != nil {
+					err = addContext(err, field, source.Name(), data)
+					if l, ok := source.(locator); ok {
+						addLocation(err, l, field.Key)
+					}
+					field.Errors = append(field.Errors, newFieldError(field, source.Name(), err))
+					continue
+				}
+				field.Provided = append(field.Provided, SourceValue{Source: source.Name(), Value: data})
+			}
+
+			if field.Collect {
+				collectEntries(field, source)
+			}
 		}
 	}
 
-	var allErrors []error
-	commandLine.VisitAll(func(f *flag.Flag) {
-		if envVar, found := getEnvVar(f.Name); found {
-			if err := commandLine.Set(f.Name, envVar); err != nil {
-				allErrors = append(allErrors, err)
+	if l.exportDotEnv {
+		exportDotEnv(prepared)
+	}
+
+	config.Loaded = true
+	return nil
+}
+
+// prepareSources returns the Loader chain of sources ready to be queried for the struct fields
+func (l *Loader) prepareSources(config *structConfig, envFiles []string) ([]Source, error) {
+	sources := l.sources
+	if sources == nil {
+		sources = defaultSources()
+	}
+
+	prepared := make([]Source, 0, len(sources))
+	for _, source := range sources {
+		if p, ok := source.(preparer); ok {
+			preparedSource, err := p.prepare(l, config, envFiles)
+			if err != nil {
+				return nil, err
 			}
+			source = preparedSource
 		}
-	})
+		prepared = append(prepared, source)
+	}
 
-	if err := commandLine.Parse(os.Args[1:]); err != nil {
-		return &FlagParseError{err}
+	return prepared, nil
+}
+
+// collectEntries sets map entries from every key the source lists under the field key, like "labels-team"
+// for a "labels" field. Entries are merged over the current map, overriding the ones with the same key
+func collectEntries(field *fieldConfig, source Source) {
+	lister, ok := source.(Lister)
+	if !ok {
+		return
 	}
 
-	if len(allErrors) > 0 {
-		errorsSet := make(map[error]bool, len(allErrors))
-		for _, err := range allErrors {
-			errorsSet[err] = true
+	prefix := field.Key + "-"
+	var keys []string
+	for _, key := range lister.Keys() {
+		if strings.HasPrefix(key, prefix) && len(key) > len(prefix) {
+			keys = append(keys, key)
 		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+	sort.Strings(keys)
 
-		return &FlagCollectionError{Errors: errorsSet}
+	// A new map keeps the field default, which may share the current map, untouched
+	merged := reflect.MakeMap(field.Value.Type())
+	for _, key := range field.Value.MapKeys() {
+		merged.SetMapIndex(key, field.Value.MapIndex(key))
 	}
 
-	return nil
+	var entries []string
+	for _, key := range keys {
+		data, found := source.Lookup(key)
+		if !found {
+			continue
+		}
+
+		entry := strings.TrimPrefix(key, prefix)
+		if err := field.Converter.setMapEntry(entry, data, merged); err != nil {
+			err = addContext(err, field, source.Name(), data)
+			if l, ok := source.(locator); ok {
+				addLocation(err, l, key)
+			}
+			field.Errors = append(field.Errors, newFieldError(field, source.Name(), err))
+			continue
+		}
+		entries = append(entries, fmt.Sprintf("%s=%s", entry, data))
+	}
+
+	if len(entries) > 0 {
+		field.Value.Set(merged)
+		field.Provided = append(field.Provided, SourceValue{Source: source.Name(), Value: strings.Join(entries, ",")})
+	}
 }
 
-func shortDesc(description string) string {
-	return fmt.Sprintf("%s (short)", description)
+// addLocation tells where a failing value was defined, when the source knows it
+func addLocation(err error, l locator, key string) {
+	var conversionError *TypeConversionError
+	if errors.As(err, &conversionError) {
+		conversionError.File, conversionError.Line = l.locate(key)
+	}
 }
 
-func getEnvVar(flagName string) (string, bool) {
-	return os.LookupEnv(strings.ReplaceAll(strings.ToUpper(flagName), "-", "_"))
+func shortDesc(description string) string {
+	return fmt.Sprintf("%s (short)", description)
 }
@@ -0,0 +1,205 @@
+package openvvar
+
+import (
+	"os"
+	"reflect"
+	"strings"
+)
+
+// Loader loads configurations into structs, holding where it should look for flags and environment variables.
+// The zero value is not usable, create one with NewLoader.
+type Loader struct {
+	args      []string
+	lookupEnv func(string) (string, bool)
+	name      string
+	sources   []Source
+	// emptyEnvAsUnset makes env vars and dot env variables with empty values count as not provided
+	emptyEnvAsUnset bool
+	// extendedDurations parses every time.Duration field with days, weeks and ISO-8601 durations
+	extendedDurations bool
+	// extendedNumbers parses every integer field with base prefixes, digit separators and magnitude suffixes
+	extendedNumbers bool
+	// exportDotEnv sets dot env variables on the process environment after loading, like godotenv.Load
+	exportDotEnv bool
+	decoders     *decoderRegistry
+	// listEnv returns the names of all environment variables, nil when they can't be listed
+	listEnv func() []string
+}
+
+// Option customizes a Loader created with NewLoader
+type Option func(*Loader)
+
+// WithArgs sets the command line arguments, without the program name, to be parsed as flags.
+// By default a Loader parses os.Args[1:]
+func WithArgs(args ...string) Option {
+	return func(l *Loader) {
+		l.args = append([]string{}, args...)
+	}
+}
+
+// WithEnvLookup sets the function used to query environment variables, by default os.LookupEnv.
+// Environment variables can't be listed with a lookup function, so map fields don't collect entries from them,
+// and elements of slices and maps of structs, like UPSTREAMS_0_HOST, aren't found on them. Use WithEnvMap instead
+func WithEnvLookup(lookupEnv func(string) (string, bool)) Option {
+	return func(l *Loader) {
+		l.lookupEnv = lookupEnv
+		l.listEnv = nil
+	}
+}
+
+// WithEnvMap makes the Loader read environment variables from the given map instead of the process environment
+func WithEnvMap(env map[string]string) Option {
+	return func(l *Loader) {
+		l.lookupEnv = func(name string) (string, bool) {
+			value, found := env[name]
+			return value, found
+		}
+		l.listEnv = func() []string {
+			names := make([]string, 0, len(env))
+			for name := range env {
+				names = append(names, name)
+			}
+			return names
+		}
+	}
+}
+
+// WithEmptyEnvAsUnset makes environment variables and dot env variables set to an empty string count as unset,
+// so they don't override lower priority sources nor satisfy required fields
+func WithEmptyEnvAsUnset() Option {
+	return func(l *Loader) {
+		l.emptyEnvAsUnset = true
+	}
+}
+
+// WithExtendedDurations makes every time.Duration field accept days and weeks, like "7d" or "2w", and ISO-8601
+// durations like "P1DT2H", as fields with the "extended" directive do
+func WithExtendedDurations() Option {
+	return func(l *Loader) {
+		l.extendedDurations = true
+	}
+}
+
+// WithExtendedNumbers makes every integer field accept base prefixes, like "0x1F", "0o755" or "0b1010", digit
+// separators like "1_000_000" and decimal magnitude suffixes like "10k" or "2M", as fields with the "extended"
+// directive do
+func WithExtendedNumbers() Option {
+	return func(l *Loader) {
+		l.extendedNumbers = true
+	}
+}
+
+// WithDotEnvExport makes the Loader set every variable read from dot env files on the process environment, without
+// overriding variables already set, like godotenv.Load. The package level Load and LoadWithReport functions do it,
+// so variables from dot env files that aren't config fields can still be read with os.Getenv
+func WithDotEnvExport() Option {
+	return func(l *Loader) {
+		l.exportDotEnv = true
+	}
+}
+
+// WithFlagSetName sets the name of the FlagSet used to parse flags, shown in usage messages.
+// By default it's os.Args[0]
+func WithFlagSetName(name string) Option {
+	return func(l *Loader) {
+		l.name = name
+	}
+}
+
+// NewLoader creates a Loader, by default reading from os.Args and the process environment
+func NewLoader(options ...Option) *Loader {
+	loader := &Loader{decoders: &decoderRegistry{}}
+	for _, option := range options {
+		option(loader)
+	}
+
+	return loader
+}
+
+// Load analyses all the Fields of the given struct for a "config" tag and queries the Loader sources.
+// Dot env files are read without changing the process environment.
+// The receiver and its nested structs may implement Defaulter, Finalizer and Validator hooks
+func (l *Loader) Load(receiverStruct interface{}, envFiles ...string) error {
+	_, err := l.load(receiverStruct, envFiles)
+	return err
+}
+
+func (l *Loader) load(receiverStruct interface{}, envFiles []string) (*structConfig, error) {
+
+	reflected := reflect.ValueOf(receiverStruct)
+
+	if !reflected.IsValid() || reflected.Kind() != reflect.Ptr || reflected.Elem().Kind() != reflect.Struct {
+		return nil, &InvalidReceiverError{}
+	}
+
+	conv := converter{
+		decoders:          l.decoders,
+		extendedDurations: l.extendedDurations,
+		extendedNumbers:   l.extendedNumbers,
+	}
+
+	structs := hookedStructs(reflected.Elem(), reflected.Elem().Type().Name(), conv)
+	setDefaults(structs)
+
+	structConfig, err := parseStruct(reflected.Elem(), structPrefix{}, conv)
+	if err != nil {
+		return nil, err
+	}
+
+	elementStructs, err := l.expandCollections(structConfig, envFiles)
+	if err != nil {
+		return nil, err
+	}
+	// Elements are nested in their parents, so their hooks are called first
+	structs = append(elementStructs, structs...)
+
+	err = l.fillData(structConfig, envFiles)
+	storeElements(structs)
+	if err != nil {
+		return structConfig, err
+	}
+
+	return structConfig, finalizeAndValidate(structs)
+}
+
+func (l *Loader) flagSetName() string {
+	if l.name != "" {
+		return l.name
+	}
+	return os.Args[0]
+}
+
+func (l *Loader) arguments() []string {
+	if l.args != nil {
+		return l.args
+	}
+	return os.Args[1:]
+}
+
+func (l *Loader) getEnv(name string) (string, bool) {
+	if l.lookupEnv != nil {
+		return l.lookupEnv(name)
+	}
+	return os.LookupEnv(name)
+}
+
+func (l *Loader) envNames() []string {
+	if l.listEnv != nil {
+		return l.listEnv()
+	}
+	if l.lookupEnv != nil {
+		return nil
+	}
+	return envNames(os.Environ())
+}
+
+// envNames takes the names from "NAME=value" environment entries
+func envNames(environ []string) []string {
+	names := make([]string, 0, len(environ))
+	for _, entry := range environ {
+		if idx := strings.Index(entry, "="); idx > 0 {
+			names = append(names, entry[:idx])
+		}
+	}
+	return names
+}
@@ -0,0 +1,101 @@
+package openvvar
+
+import (
+	"math/bits"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// numberMagnitudes maps the suffixes of extended integers to their decimal multiplier
+var numberMagnitudes = map[byte]uint64{
+	'k': 1e3,
+	'K': 1e3,
+	'M': 1e6,
+	'G': 1e9,
+	'T': 1e12,
+}
+
+// parseInt parses signed integer fields, as byte sizes with "unit=bytes" or with the extended syntax when enabled
+func (c converter) parseInt(data string, valueType reflect.Type) (int64, error) {
+	switch {
+	case c.unit == bytesUnit:
+		size, err := parseSize(data, valueType)
+		return int64(size), err
+	case c.extendedNumbers:
+		negative, magnitude, err := parseExtendedNumber(data, valueType.Bits())
+		if err != nil {
+			return 0, err
+		}
+		limit := uint64(1) << (valueType.Bits() - 1)
+		if magnitude > limit || magnitude == limit && !negative {
+			return 0, &NumberOverflowError{Value: data, Bits: valueType.Bits()}
+		}
+		if negative {
+			return int64(-magnitude), nil
+		}
+		return int64(magnitude), nil
+	}
+	return strconv.ParseInt(data, 10, valueType.Bits())
+}
+
+// parseUint parses unsigned integer fields, as byte sizes with "unit=bytes" or with the extended syntax when enabled
+func (c converter) parseUint(data string, valueType reflect.Type) (uint64, error) {
+	switch {
+	case c.unit == bytesUnit:
+		return parseSize(data, valueType)
+	case c.extendedNumbers:
+		negative, magnitude, err := parseExtendedNumber(data, valueType.Bits())
+		if err != nil {
+			return 0, err
+		}
+		if negative && magnitude != 0 {
+			return 0, &strconv.NumError{Func: "ParseUint", Num: data, Err: strconv.ErrSyntax}
+		}
+		if valueType.Bits() < 64 && magnitude >= uint64(1)<<valueType.Bits() {
+			return 0, &NumberOverflowError{Value: data, Bits: valueType.Bits()}
+		}
+		return magnitude, nil
+	}
+	return strconv.ParseUint(data, 10, valueType.Bits())
+}
+
+// parseExtendedNumber parses the sign and magnitude of integers written with a base prefix (0x, 0o or 0b), digit
+// separators like "1_000_000" and a decimal magnitude suffix (k, M, G or T), like "10k" for 10000.
+// Numbers without a base prefix are decimal, even with leading zeros
+func parseExtendedNumber(data string, bitSize int) (bool, uint64, error) {
+	text := strings.TrimSpace(data)
+
+	negative := false
+	if text != "" && (text[0] == '-' || text[0] == '+') {
+		negative = text[0] == '-'
+		text = text[1:]
+	}
+
+	multiplier := uint64(1)
+	if text != "" {
+		if magnitude, found := numberMagnitudes[text[len(text)-1]]; found {
+			multiplier = magnitude
+			text = text[:len(text)-1]
+		}
+	}
+
+	// Base 0 would read a leading zero as octal
+	for len(text) > 1 && text[0] == '0' && text[1] >= '0' && text[1] <= '9' {
+		text = text[1:]
+	}
+
+	parsed, err := strconv.ParseUint(text, 0, 64)
+	if err != nil {
+		if numErr, ok := err.(*strconv.NumError); ok && numErr.Err == strconv.ErrRange {
+			return false, 0, &NumberOverflowError{Value: data, Bits: bitSize}
+		}
+		return false, 0, &strconv.NumError{Func: "ParseInt", Num: data, Err: strconv.ErrSyntax}
+	}
+
+	high, magnitude := bits.Mul64(parsed, multiplier)
+	if high != 0 {
+		return false, 0, &NumberOverflowError{Value: data, Bits: bitSize}
+	}
+	return negative, magnitude, nil
+}
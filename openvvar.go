@@ -42,52 +42,87 @@ package openvvar
 import (
 	"errors"
 	"fmt"
-	"os"
 	"reflect"
+	"sort"
 	"strings"
-
-	"github.com/joho/godotenv"
+	"time"
 )
 
 // structConfig holds information about each field of a struct S.
 type structConfig struct {
-	Struct interface{}
-	Fields []*fieldConfig
+	Struct   interface{}
+	Fields   []*fieldConfig
+	Warnings []string
+	// Collections are slices and maps of structs, whose elements are found on the sources
+	Collections []*structCollection
+	// Templates are the fields of collection elements with a placeholder instead of their index, shown on help
+	Templates []*fieldConfig
+	// Discovering tells that sources are only listing keys to find collection elements
+	Discovering bool
+	// Loaded tells that all sources were successfully queried for the fields
+	Loaded bool
 }
 
-const shortString string = "short="
-const descriptionString string = "description="
-const defaultString string = "default="
-const optionsString string = "options="
-
-// Load analyses all the Fields of the given struct for a "config" tag and queries flags and env vars
+const shortString string = "short"
+const descriptionString string = "description"
+const defaultString string = "default"
+const optionsString string = "options"
+const aliasesString string = "aliases"
+const requiredString string = "required"
+const ignoreCaseString string = "ignorecase"
+const collectString string = "collect"
+const sepString string = "sep"
+const innerSepString string = "innersep"
+const encodingString string = "encoding"
+const formatString string = "format"
+const layoutString string = "layout"
+const timezoneString string = "timezone"
+const unitString string = "unit"
+const extendedString string = "extended"
+
+// Load analyses all the Fields of the given struct for a "config" tag and queries flags and env vars,
+// using a default Loader that reads os.Args and the process environment.
+// Variables from dot env files are set on the process environment, like with WithDotEnvExport
 func Load(receiverStruct interface{}, envFiles ...string) error {
+	return NewLoader(WithDotEnvExport()).Load(receiverStruct, envFiles...)
+}
 
-	if err := godotenv.Load(envFiles...); err != nil {
-		// We're ignoring not found errors from default .env file
-		var pathError *os.PathError
-		if !errors.As(err, &pathError) || pathError.Path != ".env" {
-			return &DotEnvNotFoundError{err}
-		}
-	}
-
-	reflected := reflect.ValueOf(receiverStruct)
-
-	if !reflected.IsValid() || reflected.Kind() != reflect.Ptr || reflected.Elem().Kind() != reflect.Struct {
-		return &InvalidReceiverError{}
+// structPrefix tells how the fields of a nested struct are named and keyed
+type structPrefix struct {
+	Name string
+	Key  string
+	// InElement tells that the struct is a collection element, whose nested structs keep the whole prefix
+	InElement bool
+	// Position is the path of field indices, and element positions, from the receiver to the struct
+	Position []int
+}
 
+// nested returns the prefix for the fields of a nested struct, which is only its field name outside collection elements
+func (p structPrefix) nested(fieldName string, index int) structPrefix {
+	if !p.InElement {
+		return structPrefix{Name: fieldName, Key: changePascalCapsToKebabCase(fieldName), Position: p.position(index)}
 	}
-
-	structConfig, err := parseStruct(reflected.Elem(), "")
-	if err != nil {
-		return err
+	return structPrefix{
+		Name:      fmt.Sprintf("%s%s.", p.Name, fieldName),
+		Key:       p.key(changePascalCapsToKebabCase(fieldName)),
+		InElement: true,
+		Position:  p.position(index),
 	}
+}
 
-	return fillData(structConfig)
+// position returns the position of a field of the struct, appending its index to the struct position
+func (p structPrefix) position(index int) []int {
+	return append(append(make([]int, 0, len(p.Position)+1), p.Position...), index)
+}
 
+func (p structPrefix) key(key string) string {
+	if p.Key == "" {
+		return key
+	}
+	return fmt.Sprintf("%s-%s", p.Key, key)
 }
 
-func parseStruct(receiverStruct reflect.Value, prefix string) (*structConfig, error) {
+func parseStruct(receiverStruct reflect.Value, prefix structPrefix, conv converter) (*structConfig, error) {
 	var structConfig structConfig
 
 	receiverStructType := receiverStruct.Type()
@@ -95,81 +130,106 @@ func parseStruct(receiverStruct reflect.Value, prefix string) (*structConfig, er
 	numFields := receiverStruct.NumField()
 	for i := 0; i < numFields; i++ {
 		field, value := receiverStructType.Field(i), receiverStruct.Field(i)
-		valueType := value.Type()
 
 		// Skipping current field if it is unexported
 		if field.PkgPath == "" {
 			// We're using "config" as out struct tag name
 			tag := field.Tag.Get("config")
 
-			// If current field is a struct or *struct, parse recursively using field name as prefix
-			switch valueType.Kind() {
-			case reflect.Struct:
-				recursiveField, err := parseStruct(value, field.Name)
+			formatted, err := hasFormat(tag)
+			if err != nil {
+				var tagError *InvalidTagError
+				if errors.As(err, &tagError) {
+					tagError.Field = fmt.Sprintf("%s%s", prefix.Name, field.Name)
+				}
+				return nil, err
+			}
+
+			// If current field is a struct or *struct, parse recursively using field name as prefix,
+			// unless it's decoded at once from a format like JSON
+			if nested, ok := conv.nestedStruct(value); ok && !formatted {
+				// Directives would be silently ignored, as nested structs are parsed field by field
+				if _, directives, _ := parseTag(tag); tag != "" && len(directives) > 0 {
+					return nil, &InvalidTagError{
+						Field:     fmt.Sprintf("%s%s", prefix.Name, field.Name),
+						Tag:       tag,
+						Directive: directives[0].Name,
+						Reason:    "directive doesn't apply to nested structs",
+					}
+				}
+
+				recursiveField, err := parseStruct(nested, prefix.nested(field.Name, i), conv)
 				if err != nil {
 					return nil, err
 				}
 
 				structConfig.Fields = append(structConfig.Fields, recursiveField.Fields...)
+				structConfig.Collections = append(structConfig.Collections, recursiveField.Collections...)
 				continue
-			case reflect.Ptr:
-				if valueType.Elem().Kind() == reflect.Struct && !value.IsNil() {
-					recursiveField, err := parseStruct(value.Elem(), field.Name)
-					if err != nil {
-						return nil, err
-					}
-					structConfig.Fields = append(structConfig.Fields, recursiveField.Fields...)
-					continue
+			}
+
+			// Slices and maps of structs have their elements found on the sources later
+			if conv.isStructCollection(value.Type()) && !formatted {
+				collection, err := parseCollection(field, value, prefix.position(i), prefix, conv)
+				if err != nil {
+					return nil, err
 				}
+
+				structConfig.Collections = append(structConfig.Collections, collection)
+				continue
 			}
 
 			// Skipping fields with empty tags or no tags at all
 			if tag != "" {
-				if prefix != "" {
-					tag = strings.Join(
-						[]string{
-							changePascalCapsToKebabCase(prefix),
-							strings.TrimSpace(tag),
-						},
-						"-",
-					)
+				fieldConfig := fieldConfig{
+					Name:      fmt.Sprintf("%s%s", prefix.Name, field.Name),
+					Value:     value,
+					Converter: conv,
+					Position:  prefix.position(i),
 				}
 
-				fieldConfig := fieldConfig{
-					Name:  fmt.Sprintf("%s%s", prefix, field.Name),
-					Key:   tag,
-					Value: value,
+				key, directives, err := parseTag(tag)
+				if err != nil {
+					var tagError *InvalidTagError
+					if errors.As(err, &tagError) {
+						tagError.Field = fieldConfig.Name
+					}
+					return nil, err
 				}
 
+				fieldConfig.Key = prefix.key(strings.ReplaceAll(changePascalCapsToKebabCase(key), "_", "-"))
+
 				// copying field content to a new value
 				clone := reflect.Indirect(reflect.New(fieldConfig.Value.Type()))
 				clone.Set(fieldConfig.Value)
 				fieldConfig.Default = clone
 
-				// Getting options for current field
-				if idx := strings.Index(tag, ";"); idx != -1 {
-					fieldConfig.Key = strings.ReplaceAll(changePascalCapsToKebabCase(tag[:idx]), "_", "-")
-
-					for _, opt := range strings.Split(tag[idx+1:], ";") {
-						if opt == "required" {
-							fieldConfig.Required = true
-						} else if strings.HasPrefix(opt, shortString) {
-							fieldConfig.Short = opt[len(shortString):]
-						} else if strings.HasPrefix(opt, descriptionString) {
-							fieldConfig.Description = opt[len(descriptionString):]
-						} else if strings.HasPrefix(opt, defaultString) {
-							if err := convert(opt[len(defaultString):], fieldConfig.Default); err != nil {
-								return nil, err
-							}
-						} else if strings.HasPrefix(opt, optionsString) {
-							fieldConfig.Options = make(map[string]bool)
-							for _, option := range strings.Split(opt[len(optionsString):], ",") {
-								fieldConfig.Options[strings.TrimSpace(option)] = true
-							}
-						}
+				// Getting options for current field, with the ones changing how values are converted first,
+				// so options and bounds are converted like the field values whatever the directives order
+				sort.SliceStable(directives, func(i, j int) bool {
+					return conversionDirectives[directives[i].Name] && !conversionDirectives[directives[j].Name]
+				})
+				for _, directive := range directives {
+					if err := fieldConfig.applyDirective(directive); err != nil {
+						err = addContext(err, &fieldConfig, "", "")
+						return nil, newFieldError(&fieldConfig, "", err)
+					}
+				}
+
+				// Every element would have the same short flag
+				if prefix.InElement {
+					fieldConfig.Short = ""
+				}
+
+				if fieldConfig.HasDefault {
+					if err := fieldConfig.Converter.convert(fieldConfig.DefaultRaw, fieldConfig.Default); err != nil {
+						err = addContext(err, &fieldConfig, "default", fieldConfig.DefaultRaw)
+						return nil, newFieldError(&fieldConfig, "default", err)
 					}
-				} else {
-					fieldConfig.Key = strings.ReplaceAll(changePascalCapsToKebabCase(tag), "_", "-")
+				}
+
+				if err := fieldConfig.parseOptions(); err != nil {
+					return nil, newFieldError(&fieldConfig, "", err)
 				}
 
 				structConfig.Fields = append(structConfig.Fields, &fieldConfig)
@@ -180,25 +240,174 @@ func parseStruct(receiverStruct reflect.Value, prefix string) (*structConfig, er
 	return &structConfig, nil
 }
 
-func fillData(structConfig *structConfig) error {
+// applyDirective sets the field configuration for a directive parsed from its tag
+func (f *fieldConfig) applyDirective(directive tagDirective) error {
+	switch directive.Name {
+	case requiredString:
+		f.Required = true
+	case shortString:
+		f.Short = directive.Value
+	case descriptionString:
+		f.Description = directive.Value
+	case defaultString:
+		f.DefaultRaw = directive.Value
+		f.HasDefault = true
+	case optionsString:
+		f.Options = make(map[string]bool)
+		for _, option := range strings.Split(directive.Value, ",") {
+			f.Options[strings.TrimSpace(option)] = true
+		}
+	case aliasesString:
+		f.Aliases = make(map[string]string)
+		for _, alias := range strings.Split(directive.Value, ",") {
+			idx := strings.Index(alias, ":")
+			if idx == -1 {
+				return &InvalidTagError{
+					Field:     f.Name,
+					Directive: directive.Name,
+					Reason:    fmt.Sprintf("alias '%s' must be written as alias:canonical", alias),
+				}
+			}
+			f.Aliases[strings.TrimSpace(alias[:idx])] = strings.TrimSpace(alias[idx+1:])
+		}
+	case ignoreCaseString:
+		f.IgnoreCase = true
+	case collectString:
+		if !f.Converter.isMap(f.Value.Type()) {
+			return &InvalidTagError{Field: f.Name, Directive: directive.Name, Reason: "directive only applies to map fields"}
+		}
+		f.Collect = true
+	case encodingString:
+		if !isBytes(f.Converter.indirectType(f.Value.Type())) && !isBytes(f.elementType()) {
+			return &InvalidTagError{Field: f.Name, Directive: directive.Name, Reason: "directive only applies to []byte fields"}
+		}
+		if !bytesEncodings[directive.Value] {
+			return &InvalidTagError{
+				Field:     f.Name,
+				Directive: directive.Name,
+				Reason:    fmt.Sprintf("encoding '%s' must be one of base64, base64url, hex or raw", directive.Value),
+			}
+		}
+		f.Converter.encoding = directive.Value
+	case formatString:
+		if directive.Value != "json" {
+			return &InvalidTagError{
+				Field:     f.Name,
+				Directive: directive.Name,
+				Reason:    fmt.Sprintf("format '%s' must be json", directive.Value),
+			}
+		}
+		f.Converter.valueFormat = directive.Value
+	case layoutString:
+		if f.elementType() != timeType {
+			return &InvalidTagError{Field: f.Name, Directive: directive.Name, Reason: "directive only applies to time.Time fields"}
+		}
+		f.Converter.layout = timeLayout(directive.Value)
+	case timezoneString:
+		if f.elementType() != timeType {
+			return &InvalidTagError{Field: f.Name, Directive: directive.Name, Reason: "directive only applies to time.Time fields"}
+		}
+		location, err := time.LoadLocation(directive.Value)
+		if err != nil {
+			return &InvalidTagError{Field: f.Name, Directive: directive.Name, Reason: err.Error()}
+		}
+		f.Converter.location = location
+	case unitString:
+		if directive.Value != bytesUnit {
+			return &InvalidTagError{
+				Field:     f.Name,
+				Directive: directive.Name,
+				Reason:    fmt.Sprintf("unit '%s' must be bytes", directive.Value),
+			}
+		}
+		if kind := f.elementType().Kind(); f.Converter.isScalar(f.elementType()) || !isInteger(kind) {
+			return &InvalidTagError{Field: f.Name, Directive: directive.Name, Reason: "directive only applies to integer fields"}
+		}
+		f.Converter.unit = directive.Value
+	case extendedString:
+		elementType := f.elementType()
+		switch {
+		case elementType == durationType:
+			f.Converter.extendedDurations = true
+		case !f.Converter.isScalar(elementType) && isInteger(elementType.Kind()):
+			f.Converter.extendedNumbers = true
+		default:
+			return &InvalidTagError{
+				Field:     f.Name,
+				Directive: directive.Name,
+				Reason:    "directive only applies to time.Duration and integer fields",
+			}
+		}
+	case sepString, innerSepString:
+		if strings.Contains(directive.Value, `"`) {
+			return &InvalidTagError{Field: f.Name, Directive: directive.Name, Reason: "separator can't have double quotes"}
+		}
+		if directive.Name == sepString {
+			f.Converter.separator = directive.Value
+		} else {
+			f.Converter.innerSeparator = directive.Value
+		}
+	default:
+		return f.parseConstraint(directive)
+	}
+
+	return nil
+}
+
+// hasFormat tells if a config tag has a "format=" directive, making the field a single value whatever its type
+func hasFormat(tag string) (bool, error) {
+	if tag == "" {
+		return false, nil
+	}
+
+	_, directives, err := parseTag(tag)
+	if err != nil {
+		return false, err
+	}
+	for _, directive := range directives {
+		if directive.Name == formatString {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// nestedStruct tells if a field value is a struct, or a non nil pointer to struct, that must be parsed recursively.
+// Structs that know how to parse themselves, like time.Time or big.Int, or with decoders are single values instead
+func (c converter) nestedStruct(value reflect.Value) (reflect.Value, bool) {
+	if c.isScalar(value.Type()) {
+		return reflect.Value{}, false
+	}
 
-	if err := loadStructData(structConfig); err != nil {
+	switch value.Kind() {
+	case reflect.Struct:
+		return value, true
+	case reflect.Ptr:
+		if value.Type().Elem().Kind() == reflect.Struct && !value.IsNil() {
+			return value.Elem(), true
+		}
+	}
+
+	return reflect.Value{}, false
+}
+
+// fillData loads the struct data and validates every field, aggregating all failures in struct order
+func (l *Loader) fillData(structConfig *structConfig, envFiles []string) error {
+
+	if err := l.loadStructData(structConfig, envFiles); err != nil {
 		return err
 	}
 
+	var fieldErrors []*FieldError
 	for _, field := range structConfig.Fields {
-		if field.Required && field.Value.IsZero() {
-			return &MissingRequiredFieldError{field.Key, field.Name}
+		if len(field.Errors) == 0 {
+			field.validate()
 		}
+		fieldErrors = append(fieldErrors, field.Errors...)
+	}
 
-		if field.Options != nil {
-			if _, ok := field.Options[field.Value.String()]; !ok {
-				return &ValueNotAValidOptionError{
-					Value:   field.Value.String(),
-					Options: field.Options,
-				}
-			}
-		}
+	if len(fieldErrors) > 0 {
+		return &FieldErrors{Errors: fieldErrors}
 	}
 
 	return nil
@@ -1,10 +1,20 @@
 package openvvar
 
 import (
+	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"math"
+	"math/big"
+	"net"
+	"net/mail"
+	"net/netip"
+	"net/url"
 	"os"
+	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
 	"testing"
@@ -181,7 +191,7 @@ func TestDefaultValue(t *testing.T) {
 func TestDefaultValueInvalidType(t *testing.T) {
 
 	s := struct {
-		InvalidType map[string]string `config:"default_name;default=Xablau"`
+		InvalidType complex128 `config:"default_name;default=Xablau"`
 	}{}
 
 	// Cleaning args so a test args can't interfere on another test
@@ -189,7 +199,7 @@ func TestDefaultValueInvalidType(t *testing.T) {
 
 	assert.True(
 		t,
-		errors.Is(Load(&s), &InvalidTypeForDefaultValuesError{Type: "map"}),
+		errors.Is(Load(&s), &InvalidTypeForDefaultValuesError{Type: "complex128"}),
 		"Openvvar must throw an InvalidTypeForDefaultValuesError error on default value for invalid field type",
 	)
 
@@ -257,11 +267,16 @@ func TestEnvValueParseFail(t *testing.T) {
 	os.Setenv("INVALID_FLOAT", "Xablau")
 	os.Setenv("INVALID_INT_SLICE", "Xablau")
 
+	err := Load(&s)
 	assert.True(
 		t,
-		errors.Is(Load(&s), &FlagCollectionError{}),
-		"Openvvar must throw an error for invalid default values",
+		errors.Is(err, &TypeConversionError{}),
+		"Openvvar must throw an error for invalid env values",
 	)
+
+	var fieldErrors *FieldErrors
+	assert.True(t, errors.As(err, &fieldErrors))
+	assert.Len(t, fieldErrors.Errors, 6, "Openvvar must report every invalid env value")
 }
 
 func TestDotEnvFile(t *testing.T) {
@@ -374,11 +389,22 @@ func TestFlagsValueParseFail(t *testing.T) {
 		"-invalid-int-slice=Xablau",
 	)
 
+	err := Load(&s)
 	assert.True(
 		t,
-		errors.Is(Load(&s), &FlagParseError{}),
-		"Openvvar must throw an error for invalid default values",
+		errors.Is(err, &TypeConversionError{}),
+		"Openvvar must throw an error for invalid flag values",
 	)
+
+	var fieldErrors *FieldErrors
+	assert.True(t, errors.As(err, &fieldErrors))
+	flagErrors := 0
+	for _, fieldError := range fieldErrors.Errors {
+		if fieldError.Source == "flag" {
+			flagErrors++
+		}
+	}
+	assert.Equal(t, 6, flagErrors, "Openvvar must report every invalid flag value")
 }
 
 func TestNotFoundEnvFile(t *testing.T) {
@@ -461,20 +487,24 @@ func TestErrors(t *testing.T) {
 	assert.False(t, errors.Is(&FlagCollectionError{}, notFound))
 	assert.False(t, errors.Is(&FlagCollectionError{errorsSet}, &FlagCollectionError{map[error]bool{}}))
 	assert.True(t, errors.Is(&FlagCollectionError{errorsSet}, &FlagCollectionError{errorsSet}))
+	collected := &FlagCollectionError{map[error]bool{&FlagParseError{notFound}: true}}
+	assert.True(t, errors.Is(collected, notFound))
+	var flagParseError *FlagParseError
+	assert.True(t, errors.As(collected, &flagParseError))
 
 	parseError := errors.New("parse error")
 	assert.Equal(t, (&FlagParseError{parseError}).Error(), "parse error")
 	assert.False(t, errors.Is(&FlagParseError{}, notFound))
 
 	conversionError := errors.New("conversion error")
-	assert.Equal(t, (&TypeConversionError{conversionError}).Error(), "conversion error")
-	assert.Equal(t, (&TypeConversionError{conversionError}).Unwrap(), conversionError)
+	assert.Equal(t, (&TypeConversionError{Err: conversionError}).Error(), "conversion error")
+	assert.Equal(t, (&TypeConversionError{Err: conversionError}).Unwrap(), conversionError)
 	assert.False(t, errors.Is(&TypeConversionError{}, conversionError))
 
 	assert.Equal(t, (&MissingRequiredFieldError{"a", "b"}).Error(), "required key 'a' for field 'b' not found")
 	assert.False(t, errors.Is(&MissingRequiredFieldError{}, conversionError))
 
-	assert.Equal(t, (&InvalidTypeForDefaultValuesError{"a"}).Error(), "field type 'a' not supported")
+	assert.Equal(t, (&InvalidTypeForDefaultValuesError{Type: "a"}).Error(), "field type 'a' not supported")
 	assert.False(t, errors.Is(&InvalidTypeForDefaultValuesError{}, conversionError))
 
 	assert.Equal(t, (&InvalidReceiverError{}).Error(), "provided config receiver must be a pointer to struct")
@@ -484,11 +514,72 @@ func TestErrors(t *testing.T) {
 		"test":  true,
 		"test2": true,
 	}
-	assert.Equal(t, (&ValueNotAValidOptionError{"not_test", optionsSet}).Error(), "received value \"not_test\" is not a valid option from [test test2]")
+	assert.Equal(t, (&ValueNotAValidOptionError{Value: "not_test", Options: optionsSet}).Error(), "received value \"not_test\" is not a valid option from [test test2]")
 	assert.False(t, errors.Is(&ValueNotAValidOptionError{}, conversionError))
-	assert.False(t, errors.Is(&ValueNotAValidOptionError{"not_test", optionsSet}, &ValueNotAValidOptionError{"wrong", map[string]bool{}}))
-	assert.True(t, errors.Is(&ValueNotAValidOptionError{"not_test", optionsSet}, &ValueNotAValidOptionError{}))
-	assert.True(t, errors.Is(&ValueNotAValidOptionError{"not_test", optionsSet}, &ValueNotAValidOptionError{"not_test", optionsSet}))
+	assert.False(t, errors.Is(&ValueNotAValidOptionError{Value: "not_test", Options: optionsSet}, &ValueNotAValidOptionError{Value: "wrong", Options: map[string]bool{}}))
+	assert.True(t, errors.Is(&ValueNotAValidOptionError{Value: "not_test", Options: optionsSet}, &ValueNotAValidOptionError{}))
+	assert.True(t, errors.Is(&ValueNotAValidOptionError{Value: "not_test", Options: optionsSet}, &ValueNotAValidOptionError{Value: "not_test", Options: optionsSet}))
+
+	assert.Equal(
+		t,
+		"invalid value \"Xablau\" at .env:3: conversion error",
+		(&TypeConversionError{Err: conversionError, Value: "Xablau", File: ".env", Line: 3}).Error(),
+	)
+	assert.Equal(
+		t,
+		"invalid value \"Xablau\": conversion error",
+		(&TypeConversionError{Err: conversionError, Value: "Xablau"}).Error(),
+	)
+	assert.True(t, errors.Is(&FlagParseError{parseError}, parseError))
+	assert.True(t, errors.Is(&FlagParseError{ErrHelp}, flag.ErrHelp))
+	assert.True(t, errors.Is(&MissingRequiredFieldError{}, ErrMissingRequiredField))
+	assert.True(t, errors.Is(&InvalidTypeForDefaultValuesError{}, ErrUnsupportedType))
+	assert.True(t, errors.Is(&InvalidReceiverError{}, ErrInvalidReceiver))
+	assert.True(t, errors.Is(&ValueNotAValidOptionError{}, ErrInvalidOption))
+	assert.False(t, errors.Is(&FlagCollectionError{errorsSet}, parseError))
+}
+
+func TestErrorsContext(t *testing.T) {
+	type Inner struct {
+		Invalid bool `config:"invalid"`
+	}
+
+	s := struct {
+		InvalidStruct Inner
+		Port          int   `config:"context-port"`
+		Ports         []int `config:"context-ports"`
+	}{}
+
+	loader := NewLoader(
+		WithArgs("-context-ports=1,Xablau,3"),
+		WithEnvMap(map[string]string{"CONTEXT_PORT": "Xaplay"}),
+	)
+	err := loader.Load(&s, "test_samples/.env.invalid_types")
+
+	assert.True(t, errors.Is(err, &TypeConversionError{
+		Field:  "InvalidStructInvalid",
+		Key:    "invalid-struct-invalid",
+		Source: "dotenv",
+	}))
+	assert.True(t, errors.Is(err, &TypeConversionError{Key: "context-port", Source: "env"}))
+	assert.True(t, errors.Is(err, &TypeConversionError{Key: "context-ports", Source: "flag"}))
+
+	var fieldErrors *FieldErrors
+	assert.True(t, errors.As(err, &fieldErrors))
+	assert.Len(t, fieldErrors.Errors, 3)
+
+	var conversionError *TypeConversionError
+	assert.True(t, errors.As(fieldErrors.Errors[0], &conversionError))
+	assert.Equal(t, "Xablau", conversionError.Value)
+	assert.Equal(t, "test_samples/.env.invalid_types", conversionError.File)
+	assert.Equal(t, 1, conversionError.Line)
+
+	assert.True(t, errors.As(fieldErrors.Errors[2], &conversionError))
+	assert.Equal(t, "Xablau", conversionError.Value)
+
+	err = NewLoader(WithArgs("-h")).Load(&s)
+	assert.True(t, errors.Is(err, ErrHelp))
+	assert.True(t, errors.Is(err, flag.ErrHelp))
 }
 
 func TestDocumentationExample(t *testing.T) {
@@ -570,3 +661,1669 @@ func TestPascalCapsConversions(t *testing.T) {
 		changePascalCapsToKebabCase("TestingPascalToKebabCaseEndingWithABBREVIATION"),
 	)
 }
+
+func TestLoaderWithoutProcessState(t *testing.T) {
+	type testStruct struct {
+		Name string `config:"loader-name;required"`
+		Port int    `config:"loader-port;default=8080"`
+		Host string `config:"loader-host;default=localhost"`
+	}
+
+	os.Setenv("LOADER_HOST", "wrong")
+
+	loader := NewLoader(
+		WithFlagSetName("isolated"),
+		WithArgs("-loader-port=9090"),
+		WithEnvMap(map[string]string{"LOADER_NAME": "right"}),
+	)
+
+	for i := 0; i < 2; i++ {
+		t.Run(fmt.Sprintf("parallel-%d", i), func(t *testing.T) {
+			t.Parallel()
+
+			s := testStruct{}
+			assert.Nil(t, loader.Load(&s))
+			assert.Equal(t, testStruct{Name: "right", Port: 9090, Host: "localhost"}, s)
+		})
+	}
+}
+
+func TestLoaderEnvLookup(t *testing.T) {
+	s := struct {
+		Test string `config:"test;required"`
+	}{}
+
+	loader := NewLoader(WithArgs(), WithEnvLookup(func(name string) (string, bool) {
+		return "", false
+	}))
+
+	// Dot env files are still a fallback for the env lookup, and must not leak to the process environment.
+	// Package level Load calls on other tests export them, so it's unset first
+	assert.Nil(t, os.Unsetenv("TEST"))
+	assert.Nil(t, loader.Load(&s, "test_samples/.env.test"))
+	assert.Equal(t, "test", s.Test)
+
+	_, found := os.LookupEnv("TEST")
+	assert.False(t, found)
+}
+
+func TestDotEnvExport(t *testing.T) {
+	type testStruct struct {
+		Field string `config:"export-field"`
+		Kept  string `config:"export-kept"`
+	}
+	t.Setenv("EXPORT_KEPT", "env")
+	t.Cleanup(func() {
+		_ = os.Unsetenv("EXPORT_FIELD")
+		_ = os.Unsetenv("EXPORT_OTHER")
+	})
+
+	s := testStruct{}
+	assert.Nil(t, NewLoader(WithArgs()).Load(&s, "test_samples/.env.export"))
+	assert.Equal(t, testStruct{Field: "from-file", Kept: "env"}, s)
+	_, found := os.LookupEnv("EXPORT_OTHER")
+	assert.False(t, found)
+
+	// Package level functions keep setting dot env variables on the process environment, without overriding
+	os.Args = os.Args[:1]
+	s = testStruct{}
+	report, err := LoadWithReport(&s, "test_samples/.env.export")
+	assert.Nil(t, err)
+	assert.Equal(t, testStruct{Field: "from-file", Kept: "env"}, s)
+	assert.Equal(t, "dotenv", report.Fields[0].Source)
+	assert.Equal(t, "other", os.Getenv("EXPORT_OTHER"))
+	assert.Equal(t, "from-file", os.Getenv("EXPORT_FIELD"))
+	assert.Equal(t, "env", os.Getenv("EXPORT_KEPT"))
+}
+
+type testSource map[string]string
+
+func (s testSource) Name() string {
+	return "test"
+}
+
+func (s testSource) Lookup(key string) (string, bool) {
+	value, found := s[key]
+	return value, found
+}
+
+func TestSourcesPrecedence(t *testing.T) {
+	type testStruct struct {
+		Name string `config:"source-name;default=default"`
+		Host string `config:"source-host;default=default"`
+		Port int    `config:"source-port;default=1"`
+	}
+
+	env := map[string]string{"SOURCE_NAME": "env", "SOURCE_HOST": "env"}
+
+	s := testStruct{}
+	loader := NewLoader(
+		WithArgs("-source-name=flag", "-source-port=2"),
+		WithEnvMap(env),
+		WithSources(DefaultSource(), FlagSource(), EnvSource()),
+	)
+	assert.Nil(t, loader.Load(&s))
+	assert.Equal(t, testStruct{Name: "env", Host: "env", Port: 2}, s)
+
+	s = testStruct{}
+	loader = NewLoader(
+		WithArgs("-source-name=flag"),
+		WithEnvMap(env),
+		WithSources(DefaultSource(), EnvSource(), FlagSource(), testSource{"source-port": "3"}),
+	)
+	assert.Nil(t, loader.Load(&s))
+	assert.Equal(t, testStruct{Name: "flag", Host: "env", Port: 3}, s)
+
+	s = testStruct{}
+	loader = NewLoader(WithArgs(), WithSources(testSource{"source-port": "Xablau"}))
+	assert.True(t, errors.Is(loader.Load(&s), &FieldError{Source: "test", Key: "source-port"}))
+}
+
+func TestDotEnvSourceFiles(t *testing.T) {
+	s := struct {
+		Test string `config:"test;default=default"`
+	}{}
+
+	loader := NewLoader(WithArgs(), WithSources(DefaultSource(), DotEnvSource("test_samples/.env.test")))
+	assert.Nil(t, loader.Load(&s))
+	assert.Equal(t, "test", s.Test)
+}
+
+func TestLoadWithReport(t *testing.T) {
+	type Database struct {
+		Port int `config:"port;short=p;default=5432"`
+	}
+
+	s := struct {
+		Database Database
+		Test     string `config:"test"`
+		Name     string `config:"report-name"`
+	}{}
+
+	loader := NewLoader(
+		WithArgs("-p=6543"),
+		WithEnvMap(map[string]string{"DATABASE_PORT": "7654", "TEST": "env"}),
+	)
+
+	report, err := loader.LoadWithReport(&s, "test_samples/.env.test", "test_samples/.env.nested.test")
+	assert.Nil(t, err)
+
+	assert.Equal(t, []FieldReport{
+		{
+			Field:  "DatabasePort",
+			Key:    "database-port",
+			EnvVar: "DATABASE_PORT",
+			Flag:   "-database-port",
+			Short:  "-p",
+			Value:  "6543",
+			Source: "flag",
+			Overridden: []SourceValue{
+				{Source: "default", Value: "5432"},
+				{Source: "env", Value: "7654"},
+			},
+		},
+		{
+			Field:      "Test",
+			Key:        "test",
+			EnvVar:     "TEST",
+			Flag:       "-test",
+			Value:      "env",
+			Source:     "env",
+			Overridden: []SourceValue{{Source: "dotenv", Value: "test"}},
+		},
+		{
+			Field:      "Name",
+			Key:        "report-name",
+			EnvVar:     "REPORT_NAME",
+			Flag:       "-report-name",
+			Value:      "",
+			Overridden: nil,
+		},
+	}, report.Fields)
+
+	assert.Equal(t, []string{"dot env variable 'INNER_NAME' doesn't match any config field"}, report.Warnings)
+
+	report, err = NewLoader(WithArgs("-undefined")).LoadWithReport(&s)
+	assert.Nil(t, report)
+	assert.True(t, errors.Is(err, &FlagParseError{}))
+}
+
+func TestFieldErrorsAggregation(t *testing.T) {
+	s := struct {
+		Name    string `config:"aggregate-name;required"`
+		Port    int    `config:"aggregate-port"`
+		Options string `config:"aggregate-options;options=option1,option2"`
+		User    string `config:"aggregate-user;required"`
+	}{}
+
+	loader := NewLoader(
+		WithArgs("-aggregate-options=not_option"),
+		WithEnvMap(map[string]string{"AGGREGATE_PORT": "Xablau"}),
+	)
+
+	err := loader.Load(&s)
+
+	var fieldErrors *FieldErrors
+	assert.True(t, errors.As(err, &fieldErrors))
+
+	assert.True(t, errors.Is(err, &MissingRequiredFieldError{Key: "aggregate-name", Field: "Name"}))
+	assert.True(t, errors.Is(err, &MissingRequiredFieldError{Key: "aggregate-user", Field: "User"}))
+	assert.True(t, errors.Is(err, &ValueNotAValidOptionError{}))
+	assert.True(t, errors.Is(err, &TypeConversionError{}))
+
+	var conversionError *TypeConversionError
+	assert.True(t, errors.As(err, &conversionError))
+
+	assert.Equal(
+		t,
+		"field 'Name' (AGGREGATE_NAME): required key 'aggregate-name' for field 'Name' not found; "+
+			"field 'Port' (AGGREGATE_PORT) from env: invalid value \"Xablau\" for int: strconv.ParseInt: parsing \"Xablau\": invalid syntax; "+
+			"field 'Options' (AGGREGATE_OPTIONS) from flag: "+
+			"received value \"not_option\" is not a valid option from [option1 option2]; "+
+			"field 'User' (AGGREGATE_USER): required key 'aggregate-user' for field 'User' not found",
+		err.Error(),
+	)
+
+	encoded, jsonErr := json.Marshal(err)
+	assert.Nil(t, jsonErr)
+	assert.JSONEq(t, `[
+		{"field": "Name", "key": "aggregate-name", "env": "AGGREGATE_NAME",
+			"reason": "required key 'aggregate-name' for field 'Name' not found"},
+		{"field": "Port", "key": "aggregate-port", "env": "AGGREGATE_PORT", "source": "env",
+			"reason": "invalid value \"Xablau\" for int: strconv.ParseInt: parsing \"Xablau\": invalid syntax"},
+		{"field": "Options", "key": "aggregate-options", "env": "AGGREGATE_OPTIONS", "source": "flag",
+			"reason": "received value \"not_option\" is not a valid option from [option1 option2]"},
+		{"field": "User", "key": "aggregate-user", "env": "AGGREGATE_USER",
+			"reason": "required key 'aggregate-user' for field 'User' not found"}
+	]`, string(encoded))
+}
+
+func TestRequiredZeroValues(t *testing.T) {
+	type testStruct struct {
+		PortOffset int    `config:"port-offset;required"`
+		Feature    bool   `config:"feature;required"`
+		Name       string `config:"required-name;required"`
+	}
+
+	s := testStruct{}
+	loader := NewLoader(
+		WithArgs("-feature=false"),
+		WithEnvMap(map[string]string{"PORT_OFFSET": "0", "REQUIRED_NAME": ""}),
+	)
+	assert.Nil(t, loader.Load(&s))
+	assert.Equal(t, testStruct{}, s)
+
+	loader = NewLoader(
+		WithArgs("-feature=false"),
+		WithEnvMap(map[string]string{"PORT_OFFSET": "0", "REQUIRED_NAME": ""}),
+		WithEmptyEnvAsUnset(),
+	)
+	err := loader.Load(&s)
+	assert.True(t, errors.Is(err, &MissingRequiredFieldError{Key: "required-name", Field: "Name"}))
+	assert.False(t, errors.Is(err, &MissingRequiredFieldError{Key: "port-offset"}))
+	assert.False(t, errors.Is(err, &MissingRequiredFieldError{Key: "feature"}))
+}
+
+func TestOptionsEveryKind(t *testing.T) {
+	type testStruct struct {
+		Int      int           `config:"options-int;options=1,2,3"`
+		Float    float64       `config:"options-float;default=0.5;options=0.5,1.5"`
+		Duration time.Duration `config:"options-duration;options=1s,1m"`
+		Strings  []string      `config:"options-strings;options=a,b,c"`
+		Ints     []int         `config:"options-ints;options=1,2,3"`
+		Database string        `config:"options-database;ignorecase;aliases=pg:postgresql,my:mysql;options=postgresql,mysql"`
+		Drivers  []string      `config:"options-drivers;ignorecase;aliases=pg:postgresql;options=postgresql,mysql"`
+	}
+
+	s := testStruct{}
+	loader := NewLoader(
+		WithArgs("-options-int=2", "-options-duration=60s", "-options-strings=a,c", "-options-ints=3,1"),
+		WithEnvMap(map[string]string{"OPTIONS_DATABASE": "PG", "OPTIONS_DRIVERS": "MySQL,pg,PostgreSQL"}),
+	)
+	assert.Nil(t, loader.Load(&s))
+	assert.Equal(t, testStruct{
+		Int:      2,
+		Float:    0.5,
+		Duration: time.Minute,
+		Strings:  []string{"a", "c"},
+		Ints:     []int{3, 1},
+		Database: "postgresql",
+		Drivers:  []string{"mysql", "postgresql", "postgresql"},
+	}, s)
+
+	s = testStruct{}
+	loader = NewLoader(
+		WithArgs("-options-int=4", "-options-duration=1s", "-options-strings=a,d", "-options-ints=1,5"),
+		WithEnvMap(map[string]string{"OPTIONS_DATABASE": "mysql"}),
+	)
+	err := loader.Load(&s)
+	assert.True(t, errors.Is(err, &ValueNotAValidOptionError{Value: "4", Options: map[string]bool{"1": true, "2": true, "3": true}}))
+	assert.True(t, errors.Is(err, &FieldError{Key: "options-strings"}))
+	assert.True(t, errors.Is(err, &FieldError{Key: "options-ints"}))
+	assert.False(t, errors.Is(err, &FieldError{Key: "options-duration"}))
+	assert.False(t, errors.Is(err, &FieldError{Key: "options-database"}))
+
+	invalid := struct {
+		Int int `config:"options-invalid;options=1,Xablau"`
+	}{}
+	assert.True(t, errors.Is(NewLoader(WithArgs()).Load(&invalid), &TypeConversionError{Key: "options-invalid"}))
+}
+
+func TestValidationDirectives(t *testing.T) {
+	type testStruct struct {
+		Port     int           `config:"validation-port;min=1;max=65535"`
+		Ratio    float64       `config:"validation-ratio;range=0..1"`
+		Timeout  time.Duration `config:"validation-timeout;min=1s;max=1m"`
+		Weights  []uint        `config:"validation-weights;max=10;minlen=1;maxlen=3"`
+		Code     string        `config:"validation-code;len=3;pattern=[A-Z]+"`
+		Endpoint string        `config:"validation-endpoint;url"`
+		Address  string        `config:"validation-address;hostport"`
+		File     string        `config:"validation-file;file"`
+		Name     string        `config:"validation-name;nonempty"`
+		Optional string        `config:"validation-optional;url"`
+	}
+
+	s := testStruct{}
+	loader := NewLoader(WithArgs(), WithEnvMap(map[string]string{
+		"VALIDATION_PORT":     "8080",
+		"VALIDATION_RATIO":    "0.5",
+		"VALIDATION_TIMEOUT":  "30s",
+		"VALIDATION_WEIGHTS":  "1,10",
+		"VALIDATION_CODE":     "ABC",
+		"VALIDATION_ENDPOINT": "https://example.com/api",
+		"VALIDATION_ADDRESS":  "localhost:8080",
+		"VALIDATION_FILE":     "test_samples/.env.test",
+		"VALIDATION_NAME":     "name",
+	}))
+	assert.Nil(t, loader.Load(&s))
+
+	s = testStruct{}
+	loader = NewLoader(WithArgs(), WithEnvMap(map[string]string{
+		"VALIDATION_PORT":     "0",
+		"VALIDATION_RATIO":    "1.5",
+		"VALIDATION_TIMEOUT":  "2m",
+		"VALIDATION_WEIGHTS":  "1,11,2,3",
+		"VALIDATION_CODE":     "AbCd",
+		"VALIDATION_ENDPOINT": "/api",
+		"VALIDATION_ADDRESS":  "localhost:99999",
+		"VALIDATION_FILE":     "test_samples",
+		"VALIDATION_NAME":     "",
+	}))
+	err := loader.Load(&s)
+
+	var fieldErrors *FieldErrors
+	assert.True(t, errors.As(err, &fieldErrors))
+	assert.Len(t, fieldErrors.Errors, 11)
+	assert.True(t, errors.Is(err, ErrConstraintViolation))
+	assert.True(t, errors.Is(err, &ConstraintViolationError{Key: "validation-port", Constraint: "min=1"}))
+	assert.True(t, errors.Is(err, &ConstraintViolationError{Key: "validation-ratio", Constraint: "range=0..1"}))
+	assert.True(t, errors.Is(err, &ConstraintViolationError{Key: "validation-timeout", Constraint: "max=1m"}))
+	assert.True(t, errors.Is(err, &ConstraintViolationError{Key: "validation-weights", Constraint: "max=10"}))
+	assert.True(t, errors.Is(err, &ConstraintViolationError{Key: "validation-weights", Constraint: "maxlen=3"}))
+	assert.True(t, errors.Is(err, &ConstraintViolationError{Key: "validation-code", Constraint: "len=3"}))
+	assert.True(t, errors.Is(err, &ConstraintViolationError{Key: "validation-code", Constraint: "pattern=[A-Z]+"}))
+	assert.True(t, errors.Is(err, &ConstraintViolationError{Key: "validation-endpoint", Constraint: "url"}))
+	assert.True(t, errors.Is(err, &ConstraintViolationError{Key: "validation-address", Constraint: "hostport"}))
+	assert.True(t, errors.Is(err, &ConstraintViolationError{Key: "validation-file", Constraint: "file"}))
+	assert.True(t, errors.Is(err, &ConstraintViolationError{Key: "validation-name", Constraint: "nonempty"}))
+	assert.False(t, errors.Is(err, &ConstraintViolationError{Key: "validation-optional"}))
+
+	assert.Equal(
+		t,
+		"field 'Port' (VALIDATION_PORT) from env: value \"0\" violates 'min=1': must be at least 1",
+		fieldErrors.Errors[0].Error(),
+	)
+
+	invalid := struct {
+		Name string `config:"validation-invalid;min=1"`
+	}{}
+	assert.True(t, errors.Is(NewLoader(WithArgs()).Load(&invalid), &InvalidTypeForDefaultValuesError{Type: "string"}))
+}
+
+type hookDatabase struct {
+	Host  string `config:"host;default=localhost"`
+	Port  int    `config:"port"`
+	User  string `config:"user;required"`
+	DSN   string
+	calls *[]string
+}
+
+func (d *hookDatabase) SetDefaults() {
+	d.Port = 5432
+	*d.calls = append(*d.calls, "database.SetDefaults")
+}
+
+func (d *hookDatabase) Finalize() error {
+	d.DSN = fmt.Sprintf("%s@%s:%d", d.User, d.Host, d.Port)
+	*d.calls = append(*d.calls, "database.Finalize")
+	return nil
+}
+
+func (d *hookDatabase) Validate() error {
+	*d.calls = append(*d.calls, "database.Validate")
+	return nil
+}
+
+type hookConfig struct {
+	Database hookDatabase
+	Replica  *hookDatabase
+	MinConns int `config:"min-conns"`
+	MaxConns int `config:"max-conns"`
+	calls    []string
+}
+
+func (c *hookConfig) SetDefaults() {
+	c.MaxConns = 10
+	c.calls = append(c.calls, "config.SetDefaults")
+}
+
+func (c *hookConfig) Validate() error {
+	c.calls = append(c.calls, "config.Validate")
+	if c.MinConns > c.MaxConns {
+		return errors.New("min-conns must not be greater than max-conns")
+	}
+	return nil
+}
+
+func TestLifecycleHooks(t *testing.T) {
+	s := hookConfig{}
+	s.Database.calls = &s.calls
+
+	loader := NewLoader(WithArgs("-database-user=root"), WithEnvMap(map[string]string{"MIN_CONNS": "5"}))
+	assert.Nil(t, loader.Load(&s))
+
+	assert.Equal(t, "root@localhost:5432", s.Database.DSN)
+	assert.Equal(t, 10, s.MaxConns)
+	assert.Equal(t, []string{
+		"database.SetDefaults",
+		"config.SetDefaults",
+		"database.Finalize",
+		"database.Validate",
+		"config.Validate",
+	}, s.calls)
+
+	s = hookConfig{Replica: &hookDatabase{}}
+	s.Database.calls = &s.calls
+	s.Replica.calls = &s.calls
+
+	loader = NewLoader(
+		WithArgs("-database-user=root", "-replica-user=replica"),
+		WithEnvMap(map[string]string{"MIN_CONNS": "50"}),
+	)
+	err := loader.Load(&s)
+	assert.True(t, errors.Is(err, &HookError{Hook: "Validate", Struct: "hookConfig"}))
+	assert.Equal(t, "Validate on 'hookConfig': min-conns must not be greater than max-conns", err.Error())
+	assert.Equal(t, "replica@localhost:5432", s.Replica.DSN)
+}
+
+func TestTagGrammar(t *testing.T) {
+	type testStruct struct {
+		Description string `config:"tag-description;default='semi;colon';description='Uses ; and \\' inside'"`
+		Escaped     string `config:"tag-escaped;default=semi\\;colon"`
+		Empty       string `config:"tag-empty;default=;description="`
+		Driver      string `config:" tag-driver ; default=postgresql ; options=postgresql,mysql"`
+	}
+
+	s := testStruct{}
+	assert.Nil(t, NewLoader(WithArgs()).Load(&s))
+	assert.Equal(t, testStruct{
+		Description: "semi;colon",
+		Escaped:     "semi;colon",
+		Empty:       "",
+		Driver:      "postgresql",
+	}, s)
+
+	key, directives, err := parseTag("tag-description;default='semi;colon';description='Uses ; and \\' inside'")
+	assert.Nil(t, err)
+	assert.Equal(t, "tag-description", key)
+	assert.Equal(t, []tagDirective{
+		{Name: "default", Value: "semi;colon", HasValue: true, Quoted: true},
+		{Name: "description", Value: "Uses ; and ' inside", HasValue: true, Quoted: true},
+	}, directives)
+
+	// Backslashes before other characters and quotes inside values are kept as written
+	legacy := struct {
+		TempDir string `config:"tag-temp-dir;default=C:\\temp\\logs"`
+		Code    string `config:"tag-code;pattern=\\d+"`
+		Note    string `config:"tag-note;default=it's fine;description=Don't touch"`
+	}{}
+	assert.Nil(t, NewLoader(WithArgs()).Load(&legacy))
+	assert.Equal(t, `C:\temp\logs`, legacy.TempDir)
+	assert.Equal(t, "it's fine", legacy.Note)
+
+	err = NewLoader(WithArgs("-tag-code=123")).Load(&legacy)
+	assert.Nil(t, err)
+	err = NewLoader(WithArgs("-tag-code=abc")).Load(&legacy)
+	assert.True(t, errors.Is(err, &ConstraintViolationError{Key: "tag-code", Constraint: `pattern=\d+`}))
+
+	_, directives, err = parseTag(`tag-note;description=Don't touch;default=it's`)
+	assert.Nil(t, err)
+	assert.Equal(t, []tagDirective{
+		{Name: "description", Value: "Don't touch", HasValue: true},
+		{Name: "default", Value: "it's", HasValue: true},
+	}, directives)
+
+	_, directives, err = parseTag(`tag-dir;default=C:\temp\`)
+	assert.Nil(t, err)
+	assert.Equal(t, `C:\temp\`, directives[0].Value)
+
+	// Free text values may look like misplaced directives
+	described := struct {
+		Ports string `config:"tag-ports;description=Listening ports, max=10;pattern=a,min=1|b"`
+	}{}
+	assert.Nil(t, NewLoader(WithArgs("-tag-ports=b")).Load(&described))
+
+	// Nested structs are parsed field by field, so directives on them are rejected
+	nested := struct {
+		DB testTenantDB `config:"db;required"`
+	}{}
+	err = NewLoader(WithArgs()).Load(&nested)
+	assert.True(t, errors.Is(err, &InvalidTagError{Field: "DB", Directive: "required"}))
+
+	keyOnly := struct {
+		DB testTenantDB `config:"db"`
+	}{}
+	err = NewLoader(WithArgs(), WithEnvMap(map[string]string{"DB_HOST": "localhost"})).Load(&keyOnly)
+	assert.Nil(t, err)
+
+	invalidTags := map[string]*InvalidTagError{
+		"name;default=postgresql,options=postgresql,mysql": {Directive: "default"},
+		"name;unknown=1":                  {Directive: "unknown"},
+		"name;required;required":          {Directive: "required"},
+		"name;short=":                     {Directive: "short"},
+		"name;short":                      {Directive: "short"},
+		"name;required=true":              {Directive: "required"},
+		"name;default='unterminated":      {},
+		";default=no-key":                 {},
+		"name;;required":                  {},
+		"name;aliases=pg":                 {Directive: "aliases"},
+		"name;description='quoted';'bad'": {},
+	}
+
+	for tag, expected := range invalidTags {
+		field := reflect.StructField{Name: "Name", Type: reflect.TypeOf(""), Tag: reflect.StructTag("config:" + strconv.Quote(tag))}
+		receiver := reflect.New(reflect.StructOf([]reflect.StructField{field}))
+
+		err := NewLoader(WithArgs()).Load(receiver.Interface())
+		assert.True(t, errors.Is(err, ErrInvalidTag), "tag %q must be invalid, got %v", tag, err)
+
+		expected.Field = "Name"
+		assert.True(t, errors.Is(err, expected), "tag %q must fail with %+v, got %v", tag, expected, err)
+	}
+}
+
+type testLevel int
+
+func (l *testLevel) UnmarshalText(text []byte) error {
+	switch strings.ToLower(string(text)) {
+	case "debug":
+		*l = -1
+	case "info":
+		*l = 0
+	case "error":
+		*l = 1
+	default:
+		return fmt.Errorf("unknown level %s", text)
+	}
+	return nil
+}
+
+func (l testLevel) MarshalText() ([]byte, error) {
+	return []byte([]string{"debug", "info", "error"}[l+1]), nil
+}
+
+type testHeaders map[string]string
+
+func (h *testHeaders) Set(data string) error {
+	idx := strings.Index(data, ":")
+	if idx == -1 {
+		return fmt.Errorf("header must be written as name:value")
+	}
+	if *h == nil {
+		*h = make(testHeaders)
+	}
+	(*h)[data[:idx]] = data[idx+1:]
+	return nil
+}
+
+func (h *testHeaders) String() string {
+	return fmt.Sprintf("%d headers", len(*h))
+}
+
+func TestCustomTypes(t *testing.T) {
+	type testStruct struct {
+		Level   testLevel   `config:"custom-level;default=info;options=info,error"`
+		Levels  []testLevel `config:"custom-levels;default=debug,error"`
+		Headers testHeaders `config:"custom-headers"`
+		Big     big.Int     `config:"custom-big;default=123456789012345678901234567890"`
+		IP      net.IP      `config:"custom-ip"`
+		Time    time.Time   `config:"custom-time"`
+	}
+
+	s := testStruct{}
+	loader := NewLoader(
+		WithArgs("-custom-level=ERROR", "-custom-headers=Accept:text/plain"),
+		WithEnvMap(map[string]string{"CUSTOM_IP": "10.0.0.1", "CUSTOM_TIME": "2020-09-10T10:00:00Z"}),
+	)
+	report, err := loader.LoadWithReport(&s)
+	assert.Nil(t, err)
+
+	expectedBig, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	assert.Equal(t, testLevel(1), s.Level)
+	assert.Equal(t, []testLevel{-1, 1}, s.Levels)
+	assert.Equal(t, testHeaders{"Accept": "text/plain"}, s.Headers)
+	assert.Equal(t, 0, expectedBig.Cmp(&s.Big))
+	assert.Equal(t, net.IPv4(10, 0, 0, 1).To16(), s.IP.To16())
+	assert.Equal(t, time.Date(2020, 9, 10, 10, 0, 0, 0, time.UTC), s.Time)
+
+	assert.Equal(t, "error", report.Fields[0].Value)
+	assert.Equal(t, "[debug error]", report.Fields[1].Value)
+	assert.Equal(t, "1 headers", report.Fields[2].Value)
+	assert.Equal(t, "123456789012345678901234567890", report.Fields[3].Value)
+	assert.Equal(t, "10.0.0.1", report.Fields[4].Value)
+
+	s = testStruct{}
+	loader = NewLoader(WithArgs("-custom-level=debug", "-custom-headers=Accept"))
+	err = loader.Load(&s)
+	assert.True(t, errors.Is(err, &FieldError{Key: "custom-level"}))
+	assert.True(t, errors.Is(err, ErrInvalidOption))
+	assert.True(t, errors.Is(err, &TypeConversionError{Key: "custom-headers", Source: "flag"}))
+}
+
+type testVendorID struct {
+	Prefix string
+	Number int
+}
+
+type testMoney int64
+
+func TestDecoderRegistry(t *testing.T) {
+	RegisterDecoder(
+		reflect.TypeOf(testVendorID{}),
+		func(data string) (interface{}, error) {
+			parts := strings.SplitN(data, "-", 2)
+			if len(parts) != 2 {
+				return nil, errors.New("vendor id must be written as prefix-number")
+			}
+			number, err := strconv.Atoi(parts[1])
+			return testVendorID{Prefix: parts[0], Number: number}, err
+		},
+		func(value interface{}) string {
+			id := value.(testVendorID)
+			return fmt.Sprintf("%s-%d", id.Prefix, id.Number)
+		},
+	)
+	RegisterDecoder(reflect.TypeOf(testMoney(0)), func(data string) (interface{}, error) {
+		return nil, errors.New("global decoder must be overridden")
+	}, nil)
+
+	type testStruct struct {
+		Vendor  testVendorID   `config:"decoder-vendor;default=acme-1"`
+		Vendors []testVendorID `config:"decoder-vendors"`
+		Price   testMoney      `config:"decoder-price;default=0.00;min=1.00"`
+	}
+
+	parseMoney := func(data string) (interface{}, error) {
+		value, err := strconv.ParseFloat(data, 64)
+		return testMoney(math.Round(value * 100)), err
+	}
+	formatMoney := func(value interface{}) string {
+		return fmt.Sprintf("%.2f", float64(value.(testMoney))/100)
+	}
+
+	s := testStruct{}
+	loader := NewLoader(
+		WithDecoder(reflect.TypeOf(testMoney(0)), parseMoney, formatMoney),
+		WithArgs("-decoder-price=19.99"),
+		WithEnvMap(map[string]string{"DECODER_VENDORS": "acme-2,globex-3"}),
+	)
+	report, err := loader.LoadWithReport(&s)
+	assert.Nil(t, err)
+	assert.Equal(t, testStruct{
+		Vendor:  testVendorID{Prefix: "acme", Number: 1},
+		Vendors: []testVendorID{{Prefix: "acme", Number: 2}, {Prefix: "globex", Number: 3}},
+		Price:   1999,
+	}, s)
+	assert.Equal(t, "acme-1", report.Fields[0].Value)
+	assert.Equal(t, "[acme-2 globex-3]", report.Fields[1].Value)
+	assert.Equal(t, "19.99", report.Fields[2].Value)
+
+	s = testStruct{}
+	loader = NewLoader(WithArgs("-decoder-vendors=acme"), WithDecoder(reflect.TypeOf(testMoney(0)), parseMoney, nil))
+	err = loader.Load(&s)
+	assert.True(t, errors.Is(err, &TypeConversionError{Key: "decoder-vendors", Source: "flag"}))
+	assert.True(t, errors.Is(err, &ConstraintViolationError{Key: "decoder-price"}))
+
+	err = NewLoader(WithArgs()).Load(&s)
+	assert.True(t, errors.Is(err, &TypeConversionError{Key: "decoder-price"}))
+}
+
+func TestMapFields(t *testing.T) {
+	type testStruct struct {
+		Labels   map[string]string        `config:"map-labels;default=team=core,tier=gold;collect"`
+		Timeouts map[string]time.Duration `config:"map-timeouts;max=1m"`
+		Weights  map[int]float64          `config:"map-weights"`
+		Tags     map[string]string        `config:"map-tags;options=a,b"`
+	}
+
+	s := testStruct{}
+	loader := NewLoader(
+		WithArgs("-map-labels-tier=platinum", "-map-weights=1=0.5,2=1.5"),
+		WithEnvMap(map[string]string{"MAP_TIMEOUTS": "users=5s,orders=30s", "MAP_LABELS_OWNER": "ops"}),
+	)
+	report, err := loader.LoadWithReport(&s, "test_samples/.env.map")
+	assert.Nil(t, err)
+	assert.Equal(t, testStruct{
+		Labels:   map[string]string{"team": "core", "tier": "platinum", "region": "eu", "owner": "ops"},
+		Timeouts: map[string]time.Duration{"users": 5 * time.Second, "orders": 30 * time.Second},
+		Weights:  map[int]float64{1: 0.5, 2: 1.5},
+	}, s)
+	assert.Empty(t, report.Warnings)
+	assert.Equal(t, []SourceValue{
+		{Source: "default", Value: "team=core,tier=gold"},
+		{Source: "dotenv", Value: "region=eu,tier=silver"},
+		{Source: "env", Value: "owner=ops"},
+	}, report.Fields[0].Overridden)
+	assert.Equal(t, "flag", report.Fields[0].Source)
+
+	s = testStruct{}
+	err = NewLoader(
+		WithArgs("-map-weights=x=1"),
+		WithEnvMap(map[string]string{"MAP_TIMEOUTS": "users=2m", "MAP_TAGS": "k=c", "MAP_LABELS": "team"}),
+	).Load(&s)
+	assert.True(t, errors.Is(err, &TypeConversionError{Key: "map-weights", Source: "flag"}))
+	assert.True(t, errors.Is(err, &TypeConversionError{Key: "map-labels", Source: "env"}))
+	assert.True(t, errors.Is(err, &ConstraintViolationError{Key: "map-timeouts", Source: "env"}))
+	assert.True(t, errors.Is(err, &ValueNotAValidOptionError{Key: "map-tags", Source: "env"}))
+
+	invalid := struct {
+		Name string `config:"map-name;collect"`
+	}{}
+	err = NewLoader(WithArgs()).Load(&invalid)
+	assert.True(t, errors.Is(err, &InvalidTagError{Field: "Name", Directive: "collect"}))
+}
+
+func TestPointerFields(t *testing.T) {
+	type testStruct struct {
+		Timeout *time.Duration `config:"pointer-timeout"`
+		Retries *int           `config:"pointer-retries;min=0"`
+		Debug   *bool          `config:"pointer-debug"`
+		Name    *string        `config:"pointer-name;default=api;options=api,worker"`
+		Hosts   *[]string      `config:"pointer-hosts"`
+		Balance *big.Int       `config:"pointer-balance"`
+	}
+
+	s := testStruct{}
+	report, err := NewLoader(
+		WithArgs("-pointer-retries=0", "-pointer-balance=100"),
+		WithEnvMap(map[string]string{"POINTER_DEBUG": "false", "POINTER_HOSTS": "a,b"}),
+	).LoadWithReport(&s)
+	assert.Nil(t, err)
+	assert.Nil(t, s.Timeout)
+	if assert.NotNil(t, s.Retries) {
+		assert.Equal(t, 0, *s.Retries)
+	}
+	if assert.NotNil(t, s.Debug) {
+		assert.False(t, *s.Debug)
+	}
+	if assert.NotNil(t, s.Name) {
+		assert.Equal(t, "api", *s.Name)
+	}
+	if assert.NotNil(t, s.Hosts) {
+		assert.Equal(t, []string{"a", "b"}, *s.Hosts)
+	}
+	if assert.NotNil(t, s.Balance) {
+		assert.Equal(t, "100", s.Balance.String())
+	}
+	assert.Equal(t, "", report.Fields[0].Value)
+	assert.Equal(t, "0", report.Fields[1].Value)
+	assert.Equal(t, "[a b]", report.Fields[4].Value)
+
+	s = testStruct{}
+	err = NewLoader(
+		WithArgs("-pointer-retries=-1", "-pointer-timeout=soon"),
+		WithEnvMap(map[string]string{"POINTER_NAME": "db"}),
+	).Load(&s)
+	assert.True(t, errors.Is(err, &ConstraintViolationError{Key: "pointer-retries", Source: "flag"}))
+	assert.True(t, errors.Is(err, &TypeConversionError{Key: "pointer-timeout", Source: "flag"}))
+	assert.True(t, errors.Is(err, &ValueNotAValidOptionError{Key: "pointer-name", Source: "env"}))
+}
+
+type testUpstreamTLS struct {
+	Enabled bool   `config:"enabled;default=true"`
+	CA      string `config:"ca"`
+}
+
+type testUpstream struct {
+	Host   string `config:"host;required"`
+	Port   int    `config:"port;default=80"`
+	Weight int    `config:"weight;default=1;options=1,2,3"`
+	TLS    testUpstreamTLS
+	Zone   string
+}
+
+func (u *testUpstream) SetDefaults() {
+	u.Zone = "default-zone"
+}
+
+func (u *testUpstream) Validate() error {
+	if u.Host == "localhost" && u.TLS.Enabled {
+		return errors.New("no TLS on localhost")
+	}
+	return nil
+}
+
+func TestSliceOfStructs(t *testing.T) {
+	type testStruct struct {
+		Upstreams []testUpstream
+		Backups   []*testUpstream `config:"backups"`
+		Name      string          `config:"slice-name;default=api"`
+	}
+
+	s := testStruct{}
+	report, err := NewLoader(
+		WithArgs("-upstreams-1-port=8080", "-upstreams-1-tls-enabled=false", "-backups-0-host=backup"),
+		WithEnvMap(map[string]string{
+			"UPSTREAMS_0_HOST":   "a.internal",
+			"UPSTREAMS_1_HOST":   "b.internal",
+			"UPSTREAMS_1_WEIGHT": "3",
+			"UPSTREAMS_0_TLS_CA": "/etc/ca.pem",
+		}),
+	).LoadWithReport(&s)
+	assert.Nil(t, err)
+	assert.Equal(t, []testUpstream{
+		{Host: "a.internal", Port: 80, Weight: 1, TLS: testUpstreamTLS{Enabled: true, CA: "/etc/ca.pem"}, Zone: "default-zone"},
+		{Host: "b.internal", Port: 8080, Weight: 3, TLS: testUpstreamTLS{Enabled: false}, Zone: "default-zone"},
+	}, s.Upstreams)
+	if assert.Len(t, s.Backups, 1) {
+		assert.Equal(t, "backup", s.Backups[0].Host)
+	}
+	assert.Equal(t, "api", s.Name)
+
+	keys := make([]string, 0, len(report.Fields))
+	for _, field := range report.Fields {
+		keys = append(keys, field.Key)
+	}
+	assert.Contains(t, keys, "upstreams-1-tls-enabled")
+	assert.NotContains(t, keys, "upstreams-<n>-host")
+	assert.Empty(t, report.Warnings)
+
+	s = testStruct{}
+	err = NewLoader(
+		WithArgs(),
+		WithEnvMap(map[string]string{"UPSTREAMS_1_PORT": "81", "UPSTREAMS_0_WEIGHT": "5"}),
+	).Load(&s)
+	assert.Len(t, s.Upstreams, 2)
+	assert.True(t, errors.Is(err, &MissingRequiredFieldError{Key: "upstreams-0-host", Field: "Upstreams[0].Host"}))
+	assert.True(t, errors.Is(err, &MissingRequiredFieldError{Key: "upstreams-1-host"}))
+	assert.True(t, errors.Is(err, &ValueNotAValidOptionError{Key: "upstreams-0-weight", Source: "env"}))
+
+	s = testStruct{}
+	err = NewLoader(WithArgs(), WithEnvMap(map[string]string{"UPSTREAMS_0_HOST": "localhost"})).Load(&s)
+	assert.True(t, errors.Is(err, &HookError{Hook: "Validate", Struct: "Upstreams[0]"}))
+
+	s = testStruct{}
+	err = NewLoader(WithArgs("-upstreams-0-hots=typo")).Load(&s)
+	var parseError *FlagParseError
+	assert.True(t, errors.As(err, &parseError))
+
+	s = testStruct{}
+	err = NewLoader(WithArgs("-h"), WithFlagSetName("slices")).Load(&s)
+	assert.True(t, errors.Is(err, ErrHelp))
+
+	// Elements on sources that can't list their keys aren't found, which is warned
+	s = testStruct{}
+	lookup := func(name string) (string, bool) {
+		value, found := map[string]string{"UPSTREAMS_0_HOST": "a.internal"}[name]
+		return value, found
+	}
+	report, err = NewLoader(WithArgs(), WithEnvLookup(lookup)).LoadWithReport(&s)
+	assert.Nil(t, err)
+	assert.Empty(t, s.Upstreams)
+	assert.Contains(
+		t,
+		report.Warnings,
+		"elements of 'upstreams' with required fields can't be found on source 'env', which can't list its keys",
+	)
+
+	report, err = NewLoader(
+		WithArgs(),
+		WithSources(DefaultSource(), testSource{"upstreams-0-host": "a.internal"}),
+	).LoadWithReport(&s)
+	assert.Nil(t, err)
+	assert.Contains(
+		t,
+		report.Warnings,
+		"elements of 'backups' with required fields can't be found on source 'test', which can't list its keys",
+	)
+
+	// New indices must follow the current elements without gaps
+	s = testStruct{Upstreams: []testUpstream{{Zone: "us-east"}}}
+	err = NewLoader(
+		WithArgs(),
+		WithEnvMap(map[string]string{"UPSTREAMS_0_HOST": "a.internal", "UPSTREAMS_1_HOST": "b.internal"}),
+	).Load(&s)
+	assert.Nil(t, err)
+	if assert.Len(t, s.Upstreams, 2) {
+		assert.Equal(t, "us-east", s.Upstreams[0].Zone)
+		assert.Equal(t, "b.internal", s.Upstreams[1].Host)
+	}
+
+	s = testStruct{}
+	err = NewLoader(WithArgs(), WithEnvMap(map[string]string{"UPSTREAMS_2_HOST": "c.internal"})).Load(&s)
+	assert.True(t, errors.Is(err, &CollectionIndexError{Key: "upstreams", Index: "2"}))
+	assert.EqualError(t, err, "invalid index '2' for 'upstreams': index 0 is missing, indices must follow each other")
+	assert.Nil(t, s.Upstreams)
+
+	s = testStruct{}
+	err = NewLoader(WithArgs(), WithEnvMap(map[string]string{"UPSTREAMS_99999999999_HOST": "huge"})).Load(&s)
+	assert.True(t, errors.Is(err, &CollectionIndexError{Key: "upstreams", Index: "99999999999"}))
+	assert.Nil(t, s.Upstreams)
+
+	s = testStruct{}
+	err = NewLoader(
+		WithArgs("-backups-0-host=backup"),
+		WithEnvMap(map[string]string{"UPSTREAMS_01_HOST": "b.internal"}),
+	).Load(&s)
+	assert.True(t, errors.Is(err, &CollectionIndexError{Key: "upstreams", Index: "01"}))
+	assert.True(t, errors.Is(err, ErrCollectionIndex))
+
+	invalid := struct {
+		Upstreams []testUpstream `config:"upstreams;required"`
+	}{}
+	err = NewLoader(WithArgs()).Load(&invalid)
+	assert.True(t, errors.Is(err, &InvalidTagError{Field: "Upstreams", Directive: "required"}))
+}
+
+type testTenantDB struct {
+	Host string `config:"host;required"`
+	Port int    `config:"port;default=5432"`
+}
+
+type testTenant struct {
+	DB        testTenantDB
+	Plan      string `config:"plan;default=free;options=free,pro"`
+	Upstreams []testUpstream
+	DSN       string
+}
+
+func (t *testTenant) Finalize() error {
+	t.DSN = fmt.Sprintf("%s:%d", t.DB.Host, t.DB.Port)
+	return nil
+}
+
+func TestMapOfStructs(t *testing.T) {
+	type testStruct struct {
+		Tenants map[string]testTenant
+		Shards  map[int]*testTenantDB `config:"shards"`
+	}
+
+	s := testStruct{}
+	err := NewLoader(
+		WithArgs("-tenants-globex-plan=pro", "-shards-2-host=shard2"),
+		WithEnvMap(map[string]string{
+			"TENANTS_ACME_DB_HOST":            "acme.db",
+			"TENANTS_ACME_CORP_DB_HOST":       "acme-corp.db",
+			"TENANTS_GLOBEX_DB_HOST":          "globex.db",
+			"TENANTS_GLOBEX_DB_PORT":          "6543",
+			"TENANTS_GLOBEX_UPSTREAMS_0_HOST": "globex.api",
+		}),
+	).Load(&s)
+	assert.Nil(t, err)
+	assert.Len(t, s.Tenants, 3)
+	assert.Equal(t, testTenant{
+		DB:   testTenantDB{Host: "acme.db", Port: 5432},
+		Plan: "free",
+		DSN:  "acme.db:5432",
+	}, s.Tenants["acme"])
+	assert.Equal(t, "acme-corp.db", s.Tenants["acme-corp"].DB.Host)
+	assert.Equal(t, "pro", s.Tenants["globex"].Plan)
+	assert.Equal(t, "globex.db:6543", s.Tenants["globex"].DSN)
+	if assert.Len(t, s.Tenants["globex"].Upstreams, 1) {
+		assert.Equal(t, "globex.api", s.Tenants["globex"].Upstreams[0].Host)
+		assert.Equal(t, "default-zone", s.Tenants["globex"].Upstreams[0].Zone)
+	}
+	if assert.Contains(t, s.Shards, 2) {
+		assert.Equal(t, testTenantDB{Host: "shard2", Port: 5432}, *s.Shards[2])
+	}
+
+	s = testStruct{Tenants: map[string]testTenant{"initech": {Plan: "pro"}}}
+	err = NewLoader(WithArgs(), WithEnvMap(map[string]string{"TENANTS_ACME_PLAN": "enterprise"})).Load(&s)
+	assert.True(t, errors.Is(err, &MissingRequiredFieldError{Key: "tenants-initech-db-host", Field: "Tenants[initech].DB.Host"}))
+	assert.True(t, errors.Is(err, &MissingRequiredFieldError{Key: "tenants-acme-db-host"}))
+	assert.True(t, errors.Is(err, &ValueNotAValidOptionError{Key: "tenants-acme-plan", Source: "env"}))
+
+	s = testStruct{}
+	err = NewLoader(WithArgs(), WithEnvMap(map[string]string{"SHARDS_FIRST_HOST": "shard"})).Load(&s)
+	assert.True(t, errors.Is(err, &TypeConversionError{Key: "shards"}))
+
+	// Help shows element flags and env vars with placeholders
+	stderr := os.Stderr
+	reader, writer, err := os.Pipe()
+	assert.Nil(t, err)
+	os.Stderr = writer
+	s = testStruct{}
+	err = NewLoader(WithArgs("-h"), WithFlagSetName("maps")).Load(&s)
+	os.Stderr = stderr
+	assert.Nil(t, writer.Close())
+	help, _ := io.ReadAll(reader)
+	assert.True(t, errors.Is(err, ErrHelp))
+	assert.Contains(t, string(help), "-tenants-<name>-db-host")
+	assert.Contains(t, string(help), "(env TENANTS_<NAME>_DB_HOST)")
+	assert.Contains(t, string(help), "(env SHARDS_<NAME>_HOST)")
+}
+
+func TestCollectionFieldsOrder(t *testing.T) {
+	type testStruct struct {
+		A         string `config:"order-a;required"`
+		Upstreams []testUpstream
+		B         int `config:"order-b;required"`
+		Tenants   map[string]testTenantDB
+		C         string `config:"order-c;default=c"`
+	}
+
+	s := testStruct{}
+	err := NewLoader(
+		WithArgs(),
+		WithEnvMap(map[string]string{"UPSTREAMS_0_PORT": "81", "UPSTREAMS_1_PORT": "82", "TENANTS_ACME_PORT": "1"}),
+	).Load(&s)
+	var fieldErrors *FieldErrors
+	if assert.True(t, errors.As(err, &fieldErrors)) {
+		keys := make([]string, 0, len(fieldErrors.Errors))
+		for _, fieldError := range fieldErrors.Errors {
+			keys = append(keys, fieldError.Key)
+		}
+		assert.Equal(t, []string{
+			"order-a", "upstreams-0-host", "upstreams-1-host", "order-b", "tenants-acme-host",
+		}, keys)
+	}
+
+	s = testStruct{}
+	report, err := NewLoader(
+		WithArgs("-order-a=a", "-order-b=1"),
+		WithEnvMap(map[string]string{"UPSTREAMS_0_HOST": "a.internal", "TENANTS_ACME_HOST": "acme"}),
+	).LoadWithReport(&s)
+	assert.Nil(t, err)
+	keys := make([]string, 0, len(report.Fields))
+	for _, field := range report.Fields {
+		keys = append(keys, field.Key)
+	}
+	assert.Equal(t, []string{
+		"order-a",
+		"upstreams-0-host", "upstreams-0-port", "upstreams-0-weight", "upstreams-0-tls-enabled", "upstreams-0-tls-ca",
+		"order-b",
+		"tenants-acme-host", "tenants-acme-port",
+		"order-c",
+	}, keys)
+}
+
+func TestArrayFields(t *testing.T) {
+	type testStruct struct {
+		Color  [3]uint8          `config:"array-color;default=255,128,0;max=200"`
+		Point  [2]float64        `config:"array-point"`
+		Names  [2]string         `config:"array-names;options=a,b,c"`
+		Delays [2]*time.Duration `config:"array-delays"`
+	}
+
+	s := testStruct{}
+	report, err := NewLoader(
+		WithArgs("-array-color=10,20,30", "-array-delays=1s,2s"),
+		WithEnvMap(map[string]string{"ARRAY_POINT": "1.5,-2.25", "ARRAY_NAMES": "a,c"}),
+	).LoadWithReport(&s)
+	assert.Nil(t, err)
+	assert.Equal(t, [3]uint8{10, 20, 30}, s.Color)
+	assert.Equal(t, [2]float64{1.5, -2.25}, s.Point)
+	assert.Equal(t, [2]string{"a", "c"}, s.Names)
+	if assert.NotNil(t, s.Delays[1]) {
+		assert.Equal(t, 2*time.Second, *s.Delays[1])
+	}
+	assert.Equal(t, "[10 20 30]", report.Fields[0].Value)
+
+	s = testStruct{}
+	err = NewLoader(
+		WithArgs("-array-point=1,2,3"),
+		WithEnvMap(map[string]string{"ARRAY_NAMES": "a,d"}),
+	).Load(&s)
+	assert.True(t, errors.Is(err, &TypeConversionError{Key: "array-point", Source: "flag"}))
+	assert.True(t, errors.Is(err, &ArrayLengthError{Expected: 2, Actual: 3}))
+	assert.True(t, errors.Is(err, ErrArrayLength))
+	assert.True(t, errors.Is(err, &ConstraintViolationError{Key: "array-color", Source: "default"}))
+	assert.True(t, errors.Is(err, &ValueNotAValidOptionError{Key: "array-names", Source: "env"}))
+	assert.Contains(t, err.Error(), "expected 2 elements, got 3")
+}
+
+func TestListSeparators(t *testing.T) {
+	type testStruct struct {
+		Origins []string          `config:"list-origins"`
+		Headers []string          `config:"list-headers;sep=|"`
+		Groups  [][]string        `config:"list-groups;default='a;b,c'"`
+		Matrix  [][]int           `config:"list-matrix;sep=' ';innersep=:"`
+		Empty   []string          `config:"list-empty;default="`
+		Weights map[string]string `config:"list-weights;sep=&"`
+	}
+
+	s := testStruct{}
+	err := NewLoader(
+		WithArgs(`-list-headers=Accept: a, b|"X-Quoted|Header"|"say ""hi"""`, "-list-matrix=1:2 3"),
+		WithEnvMap(map[string]string{
+			"LIST_ORIGINS": `https://a.com,"https://b.com,https://c.com",`,
+			"LIST_WEIGHTS": "a=1,5&b=2",
+		}),
+	).Load(&s)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"https://a.com", "https://b.com,https://c.com", ""}, s.Origins)
+	assert.Equal(t, []string{"Accept: a, b", "X-Quoted|Header", `say "hi"`}, s.Headers)
+	assert.Equal(t, [][]string{{"a", "b"}, {"c"}}, s.Groups)
+	assert.Equal(t, [][]int{{1, 2}, {3}}, s.Matrix)
+	assert.NotNil(t, s.Empty)
+	assert.Empty(t, s.Empty)
+	assert.Equal(t, map[string]string{"a": "1,5", "b": "2"}, s.Weights)
+
+	s = testStruct{}
+	err = NewLoader(
+		WithArgs(`-list-headers="unterminated`),
+		WithEnvMap(map[string]string{"LIST_ORIGINS": `"a"b`}),
+	).Load(&s)
+	assert.True(t, errors.Is(err, &TypeConversionError{Key: "list-headers", Source: "flag"}))
+	assert.True(t, errors.Is(err, &TypeConversionError{Key: "list-origins", Source: "env"}))
+
+	invalid := struct {
+		List []string `config:"list-invalid;sep='\"'"`
+	}{}
+	err = NewLoader(WithArgs()).Load(&invalid)
+	assert.True(t, errors.Is(err, &InvalidTagError{Field: "List", Directive: "sep"}))
+}
+
+func TestBytesFields(t *testing.T) {
+	type testStruct struct {
+		Raw     []byte   `config:"bytes-raw;default=secret"`
+		Key     []byte   `config:"bytes-key;encoding=base64;len=4"`
+		URLKey  []byte   `config:"bytes-url-key;encoding=base64url"`
+		Salt    []byte   `config:"bytes-salt;encoding=hex;default=cafe"`
+		Secrets [][]byte `config:"bytes-secrets;encoding=hex"`
+		IP      net.IP   `config:"bytes-ip;default=10.0.0.1"`
+	}
+
+	s := testStruct{}
+	report, err := NewLoader(
+		WithArgs("-bytes-key=3q2+7w==", "-bytes-url-key=3q2-7w"),
+		WithEnvMap(map[string]string{"BYTES_SECRETS": "00ff,0102"}),
+	).LoadWithReport(&s)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("secret"), s.Raw)
+	assert.Equal(t, []byte{0xde, 0xad, 0xbe, 0xef}, s.Key)
+	assert.Equal(t, []byte{0xde, 0xad, 0xbe, 0xef}, s.URLKey)
+	assert.Equal(t, []byte{0xca, 0xfe}, s.Salt)
+	assert.Equal(t, [][]byte{{0x00, 0xff}, {0x01, 0x02}}, s.Secrets)
+	assert.Equal(t, net.ParseIP("10.0.0.1"), s.IP)
+	assert.Equal(t, "secret", report.Fields[0].Value)
+	assert.Equal(t, "3q2+7w==", report.Fields[1].Value)
+	assert.Equal(t, "cafe", report.Fields[3].Value)
+
+	s = testStruct{}
+	err = NewLoader(
+		WithArgs("-bytes-key=3q2+", "-bytes-salt=xyz"),
+		WithEnvMap(map[string]string{"BYTES_URL_KEY": "3q2+7w"}),
+	).Load(&s)
+	assert.True(t, errors.Is(err, &ConstraintViolationError{Key: "bytes-key", Constraint: "len=4"}))
+	assert.True(t, errors.Is(err, &TypeConversionError{Key: "bytes-salt", Source: "flag"}))
+	assert.True(t, errors.Is(err, &TypeConversionError{Key: "bytes-url-key", Source: "env"}))
+
+	invalidEncoding := struct {
+		Key []byte `config:"bytes-invalid;encoding=base32"`
+	}{}
+	err = NewLoader(WithArgs()).Load(&invalidEncoding)
+	assert.True(t, errors.Is(err, &InvalidTagError{Field: "Key", Directive: "encoding"}))
+
+	invalidType := struct {
+		Key string `config:"bytes-invalid;encoding=hex"`
+	}{}
+	err = NewLoader(WithArgs()).Load(&invalidType)
+	assert.True(t, errors.Is(err, &InvalidTagError{Field: "Key", Directive: "encoding"}))
+}
+
+type testRetryPolicy struct {
+	Attempts int      `json:"attempts"`
+	Backoff  string   `json:"backoff"`
+	Codes    []int    `json:"codes"`
+	Ignored  string   `config:"ignored;default=x"`
+	Nested   struct{} `json:"-"`
+}
+
+type testJSONBackend struct {
+	Name   string `json:"name"`
+	Weight int    `json:"weight"`
+}
+
+func (b *testJSONBackend) SetDefaults() {
+	b.Weight = 10
+}
+
+func (b *testJSONBackend) Validate() error {
+	return errors.New("hooks must not be called on JSON values")
+}
+
+func TestJSONFields(t *testing.T) {
+	type testStruct struct {
+		Retry   testRetryPolicy     `config:"json-retry;format=json;default='{\"attempts\":3,\"backoff\":\"1s\"}'"`
+		Routes  map[string][]string `config:"json-routes;format=json"`
+		Ports   []int               `config:"json-ports;format=json;max=9000"`
+		Targets *[]testUpstream     `config:"json-targets;format=json"`
+		Limit   int                 `config:"json-limit;format=json;options=1,2"`
+	}
+
+	s := testStruct{}
+	report, err := NewLoader(
+		WithArgs(`-json-ports=[80, 443]`, `-json-targets=[{"Host":"a"}]`),
+		WithEnvMap(map[string]string{"JSON_ROUTES": `{"/api":["a","b"],"/web":["c"]}`, "JSON_LIMIT": "2"}),
+	).LoadWithReport(&s)
+	assert.Nil(t, err)
+	assert.Equal(t, testRetryPolicy{Attempts: 3, Backoff: "1s"}, s.Retry)
+	assert.Equal(t, map[string][]string{"/api": {"a", "b"}, "/web": {"c"}}, s.Routes)
+	assert.Equal(t, []int{80, 443}, s.Ports)
+	if assert.NotNil(t, s.Targets) {
+		assert.Equal(t, []testUpstream{{Host: "a"}}, *s.Targets)
+	}
+	assert.Equal(t, 2, s.Limit)
+	assert.Equal(t, `{"attempts":3,"backoff":"1s","codes":null,"Ignored":""}`, report.Fields[0].Value)
+	assert.Equal(t, "[80,443]", report.Fields[2].Value)
+	assert.Len(t, report.Fields, 5)
+
+	s = testStruct{}
+	err = NewLoader(
+		WithArgs(`-json-ports=[80,9443]`, `-json-retry={"attempts":"three"}`),
+		WithEnvMap(map[string]string{"JSON_ROUTES": `{"/api":`, "JSON_LIMIT": "3"}),
+	).Load(&s)
+	assert.True(t, errors.Is(err, &TypeConversionError{Key: "json-retry", Source: "flag"}))
+	assert.True(t, errors.Is(err, &TypeConversionError{Key: "json-routes", Source: "env"}))
+	assert.True(t, errors.Is(err, &ConstraintViolationError{Key: "json-ports", Source: "flag"}))
+	assert.True(t, errors.Is(err, &ValueNotAValidOptionError{Key: "json-limit", Source: "env"}))
+
+	// JSON values are single values, so their hooks aren't called
+	hooked := struct {
+		Backend testJSONBackend `config:"json-backend;format=json"`
+	}{}
+	err = NewLoader(WithArgs(`-json-backend={"name":"given"}`), WithEnvMap(map[string]string{})).Load(&hooked)
+	assert.Nil(t, err)
+	assert.Equal(t, testJSONBackend{Name: "given"}, hooked.Backend)
+
+	invalid := struct {
+		Retry testRetryPolicy `config:"json-invalid;format=yaml"`
+	}{}
+	err = NewLoader(WithArgs()).Load(&invalid)
+	assert.True(t, errors.Is(err, &InvalidTagError{Field: "Retry", Directive: "format"}))
+
+	// Invalid tags on struct fields are reported, instead of parsing the struct field by field
+	unknown := struct {
+		Retry testRetryPolicy `config:"json-unknown;format=json;bogus"`
+	}{}
+	err = NewLoader(WithArgs("-json-unknown={}")).Load(&unknown)
+	assert.True(t, errors.Is(err, &InvalidTagError{Field: "Retry", Directive: "bogus"}))
+
+	typo := struct {
+		Retry testRetryPolicy `config:"json-typo;formt=json"`
+	}{}
+	err = NewLoader(WithArgs()).Load(&typo)
+	assert.True(t, errors.Is(err, &InvalidTagError{Field: "Retry", Directive: "formt"}))
+}
+
+func TestTimeFields(t *testing.T) {
+	saoPaulo, err := time.LoadLocation("America/Sao_Paulo")
+	assert.Nil(t, err)
+
+	type testStruct struct {
+		Cutover  time.Time      `config:"time-cutover;default=2024-03-01T10:00:00Z"`
+		Window   time.Time      `config:"time-window;layout=datetime;timezone=America/Sao_Paulo"`
+		Created  time.Time      `config:"time-created;layout=unix"`
+		Expires  *time.Time     `config:"time-expires;layout=unixms"`
+		Days     []time.Time    `config:"time-days;layout=date"`
+		Custom   time.Time      `config:"time-custom;layout='02/01/2006 15h04'"`
+		Zone     *time.Location `config:"time-zone;default=UTC"`
+		Optional *time.Time     `config:"time-optional"`
+	}
+
+	s := testStruct{Zone: time.Local}
+	report, err := NewLoader(
+		WithArgs("-time-window=2024-06-01 22:00:00", "-time-created=1700000000", "-time-zone=America/Sao_Paulo"),
+		WithEnvMap(map[string]string{
+			"TIME_EXPIRES": "1700000000123",
+			"TIME_DAYS":    "2024-01-01,2024-12-25",
+			"TIME_CUSTOM":  "25/12/2024 18h30",
+		}),
+	).LoadWithReport(&s)
+	assert.Nil(t, err)
+	assert.True(t, time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC).Equal(s.Cutover))
+	assert.True(t, time.Date(2024, 6, 1, 22, 0, 0, 0, saoPaulo).Equal(s.Window))
+	assert.Equal(t, saoPaulo.String(), s.Window.Location().String())
+	assert.Equal(t, int64(1700000000), s.Created.Unix())
+	if assert.NotNil(t, s.Expires) {
+		assert.Equal(t, int64(1700000000123), s.Expires.UnixMilli())
+	}
+	assert.Equal(t, []time.Time{
+		time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 12, 25, 0, 0, 0, 0, time.UTC),
+	}, s.Days)
+	assert.True(t, time.Date(2024, 12, 25, 18, 30, 0, 0, time.UTC).Equal(s.Custom))
+	assert.Equal(t, saoPaulo.String(), s.Zone.String())
+	assert.Nil(t, s.Optional)
+
+	assert.Equal(t, "2024-03-01T10:00:00Z", report.Fields[0].Value)
+	assert.Equal(t, "2024-06-01 22:00:00", report.Fields[1].Value)
+	assert.Equal(t, "1700000000", report.Fields[2].Value)
+	assert.Equal(t, "America/Sao_Paulo", report.Fields[6].Value)
+
+	s = testStruct{}
+	err = NewLoader(
+		WithArgs("-time-cutover=2024-03-01", "-time-created=yesterday"),
+		WithEnvMap(map[string]string{"TIME_ZONE": "Mars/Olympus_Mons"}),
+	).Load(&s)
+	assert.True(t, errors.Is(err, &TypeConversionError{Key: "time-cutover", Source: "flag"}))
+	assert.True(t, errors.Is(err, &TypeConversionError{Key: "time-created", Source: "flag"}))
+	assert.True(t, errors.Is(err, &TypeConversionError{Key: "time-zone", Source: "env"}))
+
+	// Millisecond timestamps beyond the nanoseconds range of int64 keep their value
+	s = testStruct{}
+	report, err = NewLoader(
+		WithArgs("-time-expires=10000000000000000"),
+		WithEnvMap(map[string]string{}),
+	).LoadWithReport(&s)
+	assert.Nil(t, err)
+	if assert.NotNil(t, s.Expires) {
+		assert.Equal(t, int64(10000000000000000), s.Expires.UnixMilli())
+		assert.Equal(t, 318857, s.Expires.Year())
+	}
+	assert.Equal(t, "10000000000000000", report.Fields[3].Value)
+
+	invalidZone := struct {
+		Time time.Time `config:"time-invalid;timezone=Mars/Olympus_Mons"`
+	}{}
+	err = NewLoader(WithArgs()).Load(&invalidZone)
+	assert.True(t, errors.Is(err, &InvalidTagError{Field: "Time", Directive: "timezone"}))
+
+	invalidType := struct {
+		Name string `config:"time-invalid;layout=date"`
+	}{}
+	err = NewLoader(WithArgs()).Load(&invalidType)
+	assert.True(t, errors.Is(err, &InvalidTagError{Field: "Name", Directive: "layout"}))
+}
+
+func TestNetworkTypes(t *testing.T) {
+	type testStruct struct {
+		IP       net.IP          `config:"net-ip;default=10.0.0.1"`
+		Network  *net.IPNet      `config:"net-network;default=10.0.0.0/8"`
+		Networks []net.IPNet     `config:"net-networks"`
+		Addr     netip.Addr      `config:"net-addr"`
+		Prefix   netip.Prefix    `config:"net-prefix"`
+		Listen   netip.AddrPort  `config:"net-listen;default=0.0.0.0:8080"`
+		BaseURL  url.URL         `config:"net-base-url"`
+		Webhook  *url.URL        `config:"net-webhook"`
+		Filter   *regexp.Regexp  `config:"net-filter;default=^api-.*$"`
+		Admin    mail.Address    `config:"net-admin"`
+		Notify   []*mail.Address `config:"net-notify"`
+		Mode     os.FileMode     `config:"net-mode;default=0644"`
+		Unset    *url.URL        `config:"net-unset"`
+	}
+
+	s := testStruct{}
+	report, err := NewLoader(
+		WithArgs("-net-addr=::1", "-net-prefix=192.168.0.0/16", "-net-mode=0o750", "-net-networks=10.1.2.3/16,fd00::/8"),
+		WithEnvMap(map[string]string{
+			"NET_BASE_URL": "https://api.example.com/v1",
+			"NET_WEBHOOK":  "https://hooks.example.com",
+			"NET_ADMIN":    "Ops <ops@example.com>",
+			"NET_NOTIFY":   "a@example.com,b@example.com",
+		}),
+	).LoadWithReport(&s)
+	assert.Nil(t, err)
+	assert.Equal(t, net.ParseIP("10.0.0.1"), s.IP)
+	assert.Equal(t, "10.0.0.0/8", s.Network.String())
+	if assert.Len(t, s.Networks, 2) {
+		assert.Equal(t, "10.1.0.0/16", s.Networks[0].String())
+	}
+	assert.Equal(t, netip.MustParseAddr("::1"), s.Addr)
+	assert.Equal(t, netip.MustParsePrefix("192.168.0.0/16"), s.Prefix)
+	assert.Equal(t, netip.MustParseAddrPort("0.0.0.0:8080"), s.Listen)
+	assert.Equal(t, "api.example.com", s.BaseURL.Host)
+	assert.Equal(t, "hooks.example.com", s.Webhook.Host)
+	assert.True(t, s.Filter.MatchString("api-users"))
+	assert.Equal(t, mail.Address{Name: "Ops", Address: "ops@example.com"}, s.Admin)
+	if assert.Len(t, s.Notify, 2) {
+		assert.Equal(t, "b@example.com", s.Notify[1].Address)
+	}
+	assert.Equal(t, os.FileMode(0750), s.Mode)
+	assert.Nil(t, s.Unset)
+
+	values := make(map[string]string, len(report.Fields))
+	for _, field := range report.Fields {
+		values[field.Key] = field.Value
+	}
+	assert.Equal(t, "10.0.0.0/8", values["net-network"])
+	assert.Equal(t, "https://api.example.com/v1", values["net-base-url"])
+	assert.Equal(t, "^api-.*$", values["net-filter"])
+	assert.Equal(t, "0750", values["net-mode"])
+	assert.Equal(t, "", values["net-unset"])
+
+	s = testStruct{}
+	err = NewLoader(
+		WithArgs("-net-network=10.0.0.0", "-net-addr=localhost", "-net-mode=999", "-net-networks=10.0.0.0/8,bad"),
+		WithEnvMap(map[string]string{"NET_FILTER": "(", "NET_ADMIN": "not an address", "NET_WEBHOOK": "http://a b"}),
+	).Load(&s)
+	assert.True(t, errors.Is(err, &TypeConversionError{Key: "net-network", Type: "*net.IPNet"}))
+	assert.True(t, errors.Is(err, &TypeConversionError{Key: "net-networks", Type: "net.IPNet"}))
+	assert.True(t, errors.Is(err, &TypeConversionError{Key: "net-addr", Type: "netip.Addr"}))
+	assert.True(t, errors.Is(err, &TypeConversionError{Key: "net-mode", Type: "fs.FileMode"}))
+	assert.True(t, errors.Is(err, &TypeConversionError{Key: "net-filter", Type: "*regexp.Regexp"}))
+	assert.True(t, errors.Is(err, &TypeConversionError{Key: "net-admin", Type: "mail.Address"}))
+	assert.True(t, errors.Is(err, &TypeConversionError{Key: "net-webhook", Type: "*url.URL"}))
+	assert.Contains(t, err.Error(), `invalid value "10.0.0.0" for *net.IPNet`)
+}
+
+func TestByteSize(t *testing.T) {
+	sizes := map[string]ByteSize{
+		"2048":    2048,
+		"512KiB":  512 * Kibibyte,
+		"512kib":  512 * Kibibyte,
+		"10MB":    10 * Megabyte,
+		"10M":     10 * Megabyte,
+		"1.5G":    1500 * Megabyte,
+		"1.5Gi":   1536 * Mebibyte,
+		"4.1M":    4100 * Kilobyte,
+		"0.7KB":   700,
+		"1.1KB":   1100,
+		"0.75KiB": 768,
+		"2.3GiB":  0, // 2469606195.2 bytes
+		"0.7KiB":  0, // 716.8 bytes
+		".5K":     500,
+		"1.2.3K":  0,
+		"2 TiB":   2 * Tebibyte,
+		"100b":    100,
+		"0":       0,
+		"16EiB":   0,
+		"1.5":     0,
+		"12XB":    0,
+		"KiB":     0,
+		"-1KiB":   0,
+	}
+	for data, expected := range sizes {
+		size, err := ParseByteSize(data)
+		if expected == 0 && data != "0" {
+			assert.NotNil(t, err, data)
+			continue
+		}
+		assert.Nil(t, err, data)
+		assert.Equal(t, expected, size, data)
+	}
+
+	_, err := ParseByteSize("0.7KiB")
+	assert.EqualError(t, err, "byte size '0.7KiB' must be a whole number of bytes")
+
+	assert.Equal(t, "512KiB", (512 * Kibibyte).String())
+	assert.Equal(t, "1500MB", (1500 * Megabyte).String())
+	assert.Equal(t, "1GiB", Gibibyte.String())
+	assert.Equal(t, "1001B", ByteSize(1001).String())
+	assert.Equal(t, "0B", ByteSize(0).String())
+
+	type testStruct struct {
+		Cache     ByteSize  `config:"size-cache;default=64MiB;max=1GiB"`
+		BodyLimit int64     `config:"size-body-limit;min=1KiB;unit=bytes;default=1MB"`
+		Buffers   []uint32  `config:"size-buffers;unit=bytes"`
+		Small     uint8     `config:"size-small;unit=bytes"`
+		Optional  *ByteSize `config:"size-optional"`
+	}
+
+	s := testStruct{}
+	report, err := NewLoader(
+		WithArgs("-size-buffers=4KiB,1MB"),
+		WithEnvMap(map[string]string{"SIZE_BODY_LIMIT": "10 MiB", "SIZE_SMALL": "255"}),
+	).LoadWithReport(&s)
+	assert.Nil(t, err)
+	assert.Equal(t, 64*Mebibyte, s.Cache)
+	assert.Equal(t, int64(10*Mebibyte), s.BodyLimit)
+	assert.Equal(t, []uint32{4096, 1000000}, s.Buffers)
+	assert.Equal(t, uint8(255), s.Small)
+	assert.Nil(t, s.Optional)
+	assert.Equal(t, "64MiB", report.Fields[0].Value)
+	assert.Equal(t, "10MiB", report.Fields[1].Value)
+	assert.Equal(t, "[4KiB 1MB]", report.Fields[2].Value)
+
+	s = testStruct{}
+	err = NewLoader(
+		WithArgs("-size-cache=2GiB", "-size-small=1KiB"),
+		WithEnvMap(map[string]string{"SIZE_BODY_LIMIT": "512B", "SIZE_BUFFERS": "8GiB"}),
+	).Load(&s)
+	assert.True(t, errors.Is(err, &ConstraintViolationError{Key: "size-cache", Constraint: "max=1GiB"}))
+	assert.True(t, errors.Is(err, &ConstraintViolationError{Key: "size-body-limit", Constraint: "min=1KiB"}))
+	assert.True(t, errors.Is(err, &TypeConversionError{Key: "size-small", Source: "flag", Type: "uint8"}))
+	assert.True(t, errors.Is(err, strconv.ErrRange))
+	assert.True(t, errors.Is(err, &TypeConversionError{Key: "size-buffers", Source: "env"}))
+	assert.Contains(t, err.Error(), "must be at least 1KiB")
+
+	invalid := struct {
+		Name string `config:"size-invalid;unit=bytes"`
+	}{}
+	err = NewLoader(WithArgs()).Load(&invalid)
+	assert.True(t, errors.Is(err, &InvalidTagError{Field: "Name", Directive: "unit"}))
+}
+
+func TestExtendedDurations(t *testing.T) {
+	durations := map[string]time.Duration{
+		"7d":        7 * 24 * time.Hour,
+		"2w":        14 * 24 * time.Hour,
+		"1w2d3h4m":  9*24*time.Hour + 3*time.Hour + 4*time.Minute,
+		"1.5d":      36 * time.Hour,
+		"-1d":       -24 * time.Hour,
+		"90s":       90 * time.Second,
+		"250ms":     250 * time.Millisecond,
+		"0":         0,
+		"P1DT2H":    26 * time.Hour,
+		"P2W":       14 * 24 * time.Hour,
+		"PT30M":     30 * time.Minute,
+		"PT1.5S":    1500 * time.Millisecond,
+		"-P1D":      -24 * time.Hour,
+		"P1D2H":     -1,
+		"P1Y":       -1,
+		"P1M":       -1,
+		"PT":        -1,
+		"P":         -1,
+		"PT1H2H":    -1,
+		"7":         -1,
+		"7x":        -1,
+		"d":         -1,
+		"":          -1,
+		"20000000w": -1,
+	}
+	for data, expected := range durations {
+		duration, err := parseExtendedDuration(data)
+		if expected < 0 && !strings.HasPrefix(data, "-") {
+			assert.NotNil(t, err, data)
+			continue
+		}
+		assert.Nil(t, err, data)
+		assert.Equal(t, expected, duration, data)
+	}
+
+	type testStruct struct {
+		Retention time.Duration            `config:"extended-retention;extended;default=30d;max=P52W"`
+		Timeout   time.Duration            `config:"extended-timeout;default=1m"`
+		Lifetimes map[string]time.Duration `config:"extended-lifetimes;extended"`
+		Intervals []time.Duration          `config:"extended-intervals;extended"`
+	}
+
+	s := testStruct{}
+	err := NewLoader(
+		WithArgs("-extended-lifetimes=access=1h,refresh=2w", "-extended-intervals=1d,PT12H"),
+		WithEnvMap(map[string]string{}),
+	).Load(&s)
+	assert.Nil(t, err)
+	assert.Equal(t, 30*24*time.Hour, s.Retention)
+	assert.Equal(t, time.Minute, s.Timeout)
+	assert.Equal(t, map[string]time.Duration{"access": time.Hour, "refresh": 14 * 24 * time.Hour}, s.Lifetimes)
+	assert.Equal(t, []time.Duration{24 * time.Hour, 12 * time.Hour}, s.Intervals)
+
+	// Fields without the directive keep the strict syntax
+	s = testStruct{}
+	err = NewLoader(WithArgs("-extended-timeout=1d", "-extended-retention=P53W"), WithEnvMap(map[string]string{})).Load(&s)
+	assert.True(t, errors.Is(err, &TypeConversionError{Key: "extended-timeout", Source: "flag"}))
+	assert.True(t, errors.Is(err, &ConstraintViolationError{Key: "extended-retention", Constraint: "max=P52W"}))
+
+	s = testStruct{}
+	err = NewLoader(
+		WithArgs("-extended-timeout=P1DT2H"),
+		WithEnvMap(map[string]string{}),
+		WithExtendedDurations(),
+	).Load(&s)
+	assert.Nil(t, err)
+	assert.Equal(t, 26*time.Hour, s.Timeout)
+
+	invalid := struct {
+		Ratio float64 `config:"extended-ratio;extended"`
+	}{}
+	err = NewLoader(WithArgs()).Load(&invalid)
+	assert.True(t, errors.Is(err, &InvalidTagError{Field: "Ratio", Directive: "extended"}))
+}
+
+func TestExtendedNumbers(t *testing.T) {
+	numbers := map[string]int64{
+		"0x1F":      31,
+		"0X1f":      31,
+		"0o755":     493,
+		"0b1010":    10,
+		"0755":      755,
+		"1_000_000": 1000000,
+		"0x_FF_FF":  65535,
+		"10k":       10000,
+		"10K":       10000,
+		"2M":        2000000,
+		"3G":        3000000000,
+		"1T":        1000000000000,
+		"-0x10":     -16,
+		"+42":       42,
+		"0":         0,
+	}
+	for data, expected := range numbers {
+		value := int64(0)
+		err := converter{extendedNumbers: true}.convert(data, reflect.ValueOf(&value).Elem())
+		assert.Nil(t, err, data)
+		assert.Equal(t, expected, value, data)
+	}
+
+	for _, data := range []string{"", "k", "0x", "1__0", "_1", "1.5k", "10m", "0xG", "1e3"} {
+		value := int64(0)
+		err := converter{extendedNumbers: true}.convert(data, reflect.ValueOf(&value).Elem())
+		assert.True(t, errors.Is(err, strconv.ErrSyntax), data)
+	}
+
+	type testStruct struct {
+		Mode    uint32   `config:"numbers-mode;extended;default=0o644"`
+		Limit   int      `config:"numbers-limit;extended;default=10k;max=1M"`
+		Mask    uint8    `config:"numbers-mask;extended"`
+		Offset  int8     `config:"numbers-offset;extended"`
+		Weights []uint16 `config:"numbers-weights;extended"`
+		Count   int      `config:"numbers-count"`
+	}
+
+	s := testStruct{}
+	err := NewLoader(
+		WithArgs("-numbers-mask=0b1111_0000", "-numbers-weights=0x10,1k,1_000"),
+		WithEnvMap(map[string]string{"NUMBERS_OFFSET": "-128", "NUMBERS_COUNT": "12"}),
+	).Load(&s)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(0644), s.Mode)
+	assert.Equal(t, 10000, s.Limit)
+	assert.Equal(t, uint8(0xF0), s.Mask)
+	assert.Equal(t, int8(-128), s.Offset)
+	assert.Equal(t, []uint16{16, 1000, 1000}, s.Weights)
+	assert.Equal(t, 12, s.Count)
+
+	s = testStruct{}
+	err = NewLoader(
+		WithArgs("-numbers-mask=0x100", "-numbers-limit=2M", "-numbers-weights=1k,100k"),
+		WithEnvMap(map[string]string{"NUMBERS_OFFSET": "128", "NUMBERS_COUNT": "1k"}),
+	).Load(&s)
+	assert.True(t, errors.Is(err, &TypeConversionError{Key: "numbers-mask", Type: "uint8"}))
+	assert.True(t, errors.Is(err, &NumberOverflowError{Value: "0x100", Bits: 8}))
+	assert.True(t, errors.Is(err, &NumberOverflowError{Value: "128", Bits: 8}))
+	assert.True(t, errors.Is(err, &NumberOverflowError{Value: "100k", Bits: 16}))
+	assert.True(t, errors.Is(err, ErrNumberOverflow))
+	assert.True(t, errors.Is(err, &ConstraintViolationError{Key: "numbers-limit", Constraint: "max=1M"}))
+	// Fields without the directive keep the strict syntax
+	assert.True(t, errors.Is(err, &TypeConversionError{Key: "numbers-count", Source: "env"}))
+	assert.Contains(t, err.Error(), "'0x100' overflows 8 bits")
+
+	s = testStruct{}
+	err = NewLoader(
+		WithArgs("-numbers-count=0x20"),
+		WithEnvMap(map[string]string{}),
+		WithExtendedNumbers(),
+	).Load(&s)
+	assert.Nil(t, err)
+	assert.Equal(t, 32, s.Count)
+
+	err = NewLoader(
+		WithArgs("-numbers-count=-1", "-numbers-mode=-1"),
+		WithEnvMap(map[string]string{}),
+		WithExtendedNumbers(),
+	).Load(&s)
+	assert.True(t, errors.Is(err, &TypeConversionError{Key: "numbers-mode", Type: "uint32"}))
+	assert.False(t, errors.Is(err, &TypeConversionError{Key: "numbers-count"}))
+}
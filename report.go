@@ -0,0 +1,74 @@
+package openvvar
+
+// Report tells where each field got its value from on a Load, useful to debug which source won
+type Report struct {
+	Fields   []FieldReport
+	Warnings []string
+}
+
+// FieldReport holds the provenance of a single field
+type FieldReport struct {
+	Field  string
+	Key    string
+	EnvVar string
+	Flag   string
+	Short  string
+	// Value is the final value of the field
+	Value string
+	// Source is the name of the source that set the final value, empty if no source had a value for the field
+	Source string
+	// Overridden lists the values from lower priority sources, from the lowest to the highest priority
+	Overridden []SourceValue
+}
+
+// SourceValue is a raw value provided by a source
+type SourceValue struct {
+	Source string
+	Value  string
+}
+
+// LoadWithReport works just like Load, also returning a Report, using a default Loader
+func LoadWithReport(receiverStruct interface{}, envFiles ...string) (*Report, error) {
+	return NewLoader(WithDotEnvExport()).LoadWithReport(receiverStruct, envFiles...)
+}
+
+// LoadWithReport works just like Load, also returning a Report.
+// The report is also returned when fields fail validation, so it can be used to debug the failure
+func (l *Loader) LoadWithReport(receiverStruct interface{}, envFiles ...string) (*Report, error) {
+	structConfig, err := l.load(receiverStruct, envFiles)
+	if structConfig == nil || !structConfig.Loaded {
+		return nil, err
+	}
+
+	return newReport(structConfig), err
+}
+
+func newReport(config *structConfig) *Report {
+	report := &Report{
+		Fields:   make([]FieldReport, 0, len(config.Fields)),
+		Warnings: config.Warnings,
+	}
+
+	for _, field := range config.Fields {
+		fieldReport := FieldReport{
+			Field:  field.Name,
+			Key:    field.Key,
+			EnvVar: envVarName(field.Key),
+			Flag:   "-" + field.Key,
+			Value:  field.Converter.format(field.Value),
+		}
+
+		if field.Short != "" {
+			fieldReport.Short = "-" + field.Short
+		}
+
+		if provided := len(field.Provided); provided > 0 {
+			fieldReport.Source = field.source()
+			fieldReport.Overridden = field.Provided[:provided-1]
+		}
+
+		report.Fields = append(report.Fields, fieldReport)
+	}
+
+	return report
+}
@@ -0,0 +1,399 @@
+package openvvar
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+// Source provides raw values for configuration keys, like "database-port" for a field
+// tagged `config:"port"` inside a Database struct.
+type Source interface {
+	// Name identifies the source, like "env" or "flag"
+	Name() string
+	// Lookup returns the raw value for a key and if the source has a value for it at all
+	Lookup(key string) (string, bool)
+}
+
+// Lister is implemented by sources that can list their keys, needed by map fields with the "collect" directive.
+// Keys are written like lookup keys, so the env var LABELS_TEAM is listed as "labels-team"
+type Lister interface {
+	Keys() []string
+}
+
+// preparer is implemented by built-in sources that need the Loader and the parsed fields before any lookup.
+// They return a new Source so the same Loader can be used concurrently.
+type preparer interface {
+	prepare(l *Loader, config *structConfig, envFiles []string) (Source, error)
+}
+
+// locator is implemented by sources that know where a key value was defined, like a dot env file line
+type locator interface {
+	locate(key string) (file string, line int)
+}
+
+// DefaultSource provides the values from "default=" directives on struct tags
+func DefaultSource() Source {
+	return &defaultSource{}
+}
+
+// DotEnvSource provides values from dot env files, looked up by env var name like "DATABASE_PORT".
+// Without files, it reads the files passed to Load, or ".env" if it exists
+func DotEnvSource(files ...string) Source {
+	return &dotEnvSource{files: files}
+}
+
+// EnvSource provides values from environment variables, looked up by env var name like "DATABASE_PORT"
+func EnvSource() Source {
+	return &envSource{}
+}
+
+// FlagSource provides values from command line flags, looked up by flag name like "-database-port"
+func FlagSource() Source {
+	return &flagSource{}
+}
+
+// WithSources sets the ordered chain of sources, from lowest to highest priority.
+// By default it's DefaultSource, DotEnvSource, EnvSource and FlagSource
+func WithSources(sources ...Source) Option {
+	return func(l *Loader) {
+		l.sources = append([]Source{}, sources...)
+	}
+}
+
+func defaultSources() []Source {
+	return []Source{DefaultSource(), DotEnvSource(), EnvSource(), FlagSource()}
+}
+
+func envVarName(key string) string {
+	return strings.ReplaceAll(strings.ToUpper(key), "-", "_")
+}
+
+// envVarKeys converts env var names back to keys, skipping names that wouldn't be found by their key, like lower case ones
+func envVarKeys(names []string) []string {
+	keys := make([]string, 0, len(names))
+	for _, name := range names {
+		key := strings.ReplaceAll(strings.ToLower(name), "_", "-")
+		if envVarName(key) == name {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+type defaultSource struct {
+	defaults map[string]string
+}
+
+func (s *defaultSource) Name() string {
+	return "default"
+}
+
+func (s *defaultSource) Lookup(key string) (string, bool) {
+	value, found := s.defaults[key]
+	return value, found
+}
+
+func (s *defaultSource) prepare(_ *Loader, config *structConfig, _ []string) (Source, error) {
+	prepared := &defaultSource{defaults: make(map[string]string)}
+	for _, field := range config.Fields {
+		if field.HasDefault {
+			prepared.defaults[field.Key] = field.DefaultRaw
+		}
+	}
+
+	return prepared, nil
+}
+
+type dotEnvSource struct {
+	files        []string
+	values       map[string]string
+	locations    map[string]dotEnvLocation
+	emptyAsUnset bool
+}
+
+type dotEnvLocation struct {
+	file string
+	line int
+}
+
+func (s *dotEnvSource) Name() string {
+	return "dotenv"
+}
+
+func (s *dotEnvSource) Lookup(key string) (string, bool) {
+	value, found := s.values[envVarName(key)]
+	if s.emptyAsUnset && value == "" {
+		return "", false
+	}
+	return value, found
+}
+
+// prepare reads the dot env files, warning about variables that don't match any field, which are usually typos
+func (s *dotEnvSource) prepare(l *Loader, config *structConfig, envFiles []string) (Source, error) {
+	files := s.files
+	if len(files) == 0 {
+		files = envFiles
+	}
+
+	values, err := godotenv.Read(files...)
+	if err != nil {
+		// We're ignoring not found errors from default .env file
+		var pathError *os.PathError
+		if !errors.As(err, &pathError) || pathError.Path != ".env" {
+			return nil, &DotEnvNotFoundError{err}
+		}
+	}
+
+	envVars := make(map[string]bool, len(config.Fields))
+	var collectPrefixes []string
+	for _, field := range config.Fields {
+		envVars[envVarName(field.Key)] = true
+		if field.Collect {
+			collectPrefixes = append(collectPrefixes, envVarName(field.Key)+"_")
+		}
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		if !envVars[name] && !hasAnyPrefix(name, collectPrefixes) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		config.Warnings = append(
+			config.Warnings,
+			fmt.Sprintf("dot env variable '%s' doesn't match any config field", name),
+		)
+	}
+
+	return &dotEnvSource{
+		files:        files,
+		values:       values,
+		locations:    dotEnvLocations(files),
+		emptyAsUnset: l.emptyEnvAsUnset,
+	}, nil
+}
+
+func (s *dotEnvSource) Keys() []string {
+	names := make([]string, 0, len(s.values))
+	for name := range s.values {
+		names = append(names, name)
+	}
+	return envVarKeys(names)
+}
+
+func (s *dotEnvSource) locate(key string) (string, int) {
+	location := s.locations[envVarName(key)]
+	return location.file, location.line
+}
+
+// exportDotEnv sets the variables of dot env sources on the process environment, keeping the ones already set.
+// It runs after every field is looked up, so values from dot env files aren't reported as coming from env vars
+func exportDotEnv(sources []Source) {
+	for _, source := range sources {
+		dotEnv, ok := source.(*dotEnvSource)
+		if !ok {
+			continue
+		}
+		for name, value := range dotEnv.values {
+			if _, set := os.LookupEnv(name); !set {
+				_ = os.Setenv(name, value)
+			}
+		}
+	}
+}
+
+// dotEnvLocations finds the line defining each variable, later files overriding earlier ones like godotenv.Read
+func dotEnvLocations(files []string) map[string]dotEnvLocation {
+	if len(files) == 0 {
+		files = []string{".env"}
+	}
+
+	locations := make(map[string]dotEnvLocation)
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			continue
+		}
+
+		for index, line := range strings.Split(string(content), "\n") {
+			line = strings.TrimPrefix(strings.TrimSpace(line), "export ")
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			if idx := strings.IndexAny(line, "=:"); idx != -1 {
+				locations[strings.TrimSpace(line[:idx])] = dotEnvLocation{file: file, line: index + 1}
+			}
+		}
+	}
+
+	return locations
+}
+
+type envSource struct {
+	loader *Loader
+}
+
+func (s *envSource) Name() string {
+	return "env"
+}
+
+func (s *envSource) Lookup(key string) (string, bool) {
+	if s.loader == nil {
+		return os.LookupEnv(envVarName(key))
+	}
+
+	value, found := s.loader.getEnv(envVarName(key))
+	if s.loader.emptyEnvAsUnset && value == "" {
+		return "", false
+	}
+	return value, found
+}
+
+func (s *envSource) Keys() []string {
+	if s.loader == nil {
+		return envVarKeys(envNames(os.Environ()))
+	}
+	return envVarKeys(s.loader.envNames())
+}
+
+// listable tells if the environment variables can be listed, which they can't when read with WithEnvLookup
+func (s *envSource) listable() bool {
+	return s.loader == nil || s.loader.listEnv != nil || s.loader.lookupEnv == nil
+}
+
+func (s *envSource) prepare(l *Loader, _ *structConfig, _ []string) (Source, error) {
+	return &envSource{loader: l}, nil
+}
+
+type flagSource struct {
+	values map[string]string
+}
+
+func (s *flagSource) Name() string {
+	return "flag"
+}
+
+func (s *flagSource) Lookup(key string) (string, bool) {
+	value, found := s.values[key]
+	return value, found
+}
+
+func (s *flagSource) Keys() []string {
+	keys := make([]string, 0, len(s.values))
+	for key := range s.values {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// prepare defines flags for every field and parses the command line args, recording raw values by field key
+func (s *flagSource) prepare(l *Loader, config *structConfig, _ []string) (Source, error) {
+	prepared := &flagSource{values: make(map[string]string)}
+
+	commandLine := flag.NewFlagSet(l.flagSetName(), flag.ContinueOnError)
+
+	for _, field := range config.Fields {
+		value := &flagValue{field: field, key: field.Key, values: prepared.values}
+		commandLine.Var(value, field.Key, field.Description)
+		if field.Short != "" {
+			commandLine.Var(value, field.Short, shortDesc(field.Description))
+		}
+	}
+
+	// Templates like "-upstreams-<n>-host" only show on help how collection elements are set, by flag and env var
+	for _, field := range config.Templates {
+		usage := strings.TrimSpace(fmt.Sprintf("%s (env %s)", field.Description, envVarName(field.Key)))
+		commandLine.Var(&flagValue{field: field, key: field.Key, values: prepared.values}, field.Key, usage)
+	}
+
+	// Map entries and collection elements aren't known beforehand, so their flags are found on the args
+	for _, name := range flagNames(l.arguments()) {
+		if commandLine.Lookup(name) != nil {
+			continue
+		}
+		for _, field := range config.Fields {
+			if field.Collect && strings.HasPrefix(name, field.Key+"-") {
+				value := &flagValue{field: field, key: name, values: prepared.values}
+				commandLine.Var(value, name, fmt.Sprintf("%s (%s entry)", field.Description, field.Key))
+				break
+			}
+		}
+		if commandLine.Lookup(name) != nil {
+			continue
+		}
+		for _, collection := range config.Collections {
+			if config.Discovering && strings.HasPrefix(name, collection.Key+"-") {
+				commandLine.Var(&flagValue{key: name, values: prepared.values}, name, "")
+				break
+			}
+		}
+	}
+
+	if err := commandLine.Parse(l.arguments()); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, &FlagParseError{ErrHelp}
+		}
+		return nil, &FlagParseError{err}
+	}
+
+	return prepared, nil
+}
+
+// flagNames returns the names of the flags on the command line args, until the "--" terminator
+func flagNames(args []string) []string {
+	var names []string
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+
+		name := strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+		if idx := strings.Index(name, "="); idx != -1 {
+			name = name[:idx]
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func hasAnyPrefix(name string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// flagValue complies with flag.Value, only recording values so conversion errors are reported with other sources
+type flagValue struct {
+	field  *fieldConfig
+	key    string
+	values map[string]string
+}
+
+func (v *flagValue) Set(data string) error {
+	v.values[v.key] = data
+	return nil
+}
+
+func (v *flagValue) String() string {
+	if v.field == nil {
+		return ""
+	}
+	return v.field.String()
+}
@@ -0,0 +1,194 @@
+package openvvar
+
+import (
+	"fmt"
+	"strings"
+)
+
+// directives lists every known tag directive, telling if it takes a value
+var directives = map[string]bool{
+	shortString:       true,
+	descriptionString: true,
+	defaultString:     true,
+	optionsString:     true,
+	aliasesString:     true,
+	minString:         true,
+	maxString:         true,
+	rangeString:       true,
+	lenString:         true,
+	minLenString:      true,
+	maxLenString:      true,
+	patternString:     true,
+	sepString:         true,
+	innerSepString:    true,
+	encodingString:    true,
+	formatString:      true,
+	layoutString:      true,
+	timezoneString:    true,
+	unitString:        true,
+	requiredString:    false,
+	ignoreCaseString:  false,
+	collectString:     false,
+	extendedString:    false,
+	urlString:         false,
+	hostPortString:    false,
+	fileString:        false,
+	nonEmptyString:    false,
+}
+
+// conversionDirectives lists directives changing how values are converted, applied before the other ones
+var conversionDirectives = map[string]bool{
+	sepString:      true,
+	innerSepString: true,
+	encodingString: true,
+	formatString:   true,
+	layoutString:   true,
+	timezoneString: true,
+	unitString:     true,
+	extendedString: true,
+}
+
+// emptyValueDirectives lists directives accepting an empty value, like an empty string default
+var emptyValueDirectives = map[string]bool{
+	descriptionString: true,
+	defaultString:     true,
+}
+
+// freeTextDirectives lists directives whose values are free text, like descriptions or regular expressions,
+// which may have ',' followed by a directive name and '=' without it being a misplaced directive
+var freeTextDirectives = map[string]bool{
+	descriptionString: true,
+	patternString:     true,
+	layoutString:      true,
+}
+
+// tagDirective is a single "name=value" or "name" directive from a config tag
+type tagDirective struct {
+	Name     string
+	Value    string
+	HasValue bool
+	// Quoted tells that the value had quoted parts, so it isn't checked for misplaced directives
+	Quoted bool
+}
+
+func (d tagDirective) String() string {
+	if !d.HasValue {
+		return d.Name
+	}
+	return fmt.Sprintf("%s=%s", d.Name, d.Value)
+}
+
+// parseTag splits a config tag like "port;default=5432;description='Port; for TCP'" into its key and directives.
+// Directives are separated by ';' and values starting with a single quote are quoted up to the next one, so other
+// single quotes are kept, like in "Don't". Backslashes escape ';', single quotes and backslashes, and are kept before
+// any other character, like in Windows paths or regular expressions. Unquoted values have surrounding spaces trimmed.
+func parseTag(tag string) (string, []tagDirective, error) {
+	var segments []tagDirective
+	var current tagDirective
+	var builder strings.Builder
+	inQuotes := false
+
+	finishName := func() {
+		current.Name = strings.TrimSpace(builder.String())
+		builder.Reset()
+	}
+	finishSegment := func() {
+		if current.HasValue {
+			current.Value = builder.String()
+			if !current.Quoted {
+				current.Value = strings.TrimSpace(current.Value)
+			}
+		} else {
+			current.Name = strings.TrimSpace(builder.String())
+		}
+		builder.Reset()
+		segments = append(segments, current)
+		current = tagDirective{}
+	}
+
+	runes := []rune(tag)
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; {
+		case r == '\\' && i+1 < len(runes) && strings.ContainsRune(`;'\`, runes[i+1]):
+			i++
+			builder.WriteRune(runes[i])
+		case r == '\'' && !current.HasValue:
+			return "", nil, &InvalidTagError{Tag: tag, Reason: "quotes are only allowed on directive values"}
+		case r == '\'' && inQuotes:
+			inQuotes = false
+		case r == '\'' && !current.Quoted && strings.TrimSpace(builder.String()) == "":
+			// Only a quote starting the value opens a quoted value
+			builder.Reset()
+			inQuotes = true
+			current.Quoted = true
+		case inQuotes:
+			builder.WriteRune(r)
+		case r == ';':
+			finishSegment()
+		case r == '=' && !current.HasValue && len(segments) > 0:
+			finishName()
+			current.HasValue = true
+		default:
+			builder.WriteRune(r)
+		}
+	}
+
+	if inQuotes {
+		return "", nil, &InvalidTagError{Tag: tag, Reason: "unterminated quoted value"}
+	}
+	finishSegment()
+
+	key := segments[0].Name
+	if key == "" {
+		return "", nil, &InvalidTagError{Tag: tag, Reason: "empty key"}
+	}
+	if strings.ContainsAny(key, "=' ") {
+		return "", nil, &InvalidTagError{Tag: tag, Reason: fmt.Sprintf("invalid key '%s'", key)}
+	}
+
+	seen := make(map[string]bool, len(segments)-1)
+	for _, directive := range segments[1:] {
+		if err := checkDirective(directive, seen); err != nil {
+			err.Tag = tag
+			return "", nil, err
+		}
+	}
+
+	return key, segments[1:], nil
+}
+
+func checkDirective(directive tagDirective, seen map[string]bool) *InvalidTagError {
+	takesValue, known := directives[directive.Name]
+	switch {
+	case directive.Name == "":
+		return &InvalidTagError{Reason: "empty directive"}
+	case !known:
+		return &InvalidTagError{Directive: directive.Name, Reason: "unknown directive"}
+	case seen[directive.Name]:
+		return &InvalidTagError{Directive: directive.Name, Reason: "duplicated directive"}
+	case takesValue && !directive.HasValue:
+		return &InvalidTagError{Directive: directive.Name, Reason: "directive requires a value"}
+	case !takesValue && directive.HasValue:
+		return &InvalidTagError{Directive: directive.Name, Reason: "directive doesn't take a value"}
+	case takesValue && directive.Value == "" && !emptyValueDirectives[directive.Name]:
+		return &InvalidTagError{Directive: directive.Name, Reason: "directive value must not be empty"}
+	}
+	seen[directive.Name] = true
+
+	// Catching directives separated by ',' instead of ';', like "default=postgresql,options=postgresql,mysql"
+	if !directive.Quoted && !freeTextDirectives[directive.Name] {
+		for _, part := range strings.Split(directive.Value, ",")[1:] {
+			if idx := strings.Index(part, "="); idx != -1 && directives[strings.TrimSpace(part[:idx])] {
+				return &InvalidTagError{
+					Directive: directive.Name,
+					Reason: fmt.Sprintf(
+						"value contains directive '%s', separate directives with ';' or quote the value",
+						strings.TrimSpace(part[:idx]),
+					),
+				}
+			}
+		}
+	}
+
+	return nil
+}
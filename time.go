@@ -0,0 +1,89 @@
+package openvvar
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+var locationType = reflect.TypeOf((*time.Location)(nil))
+
+const unixLayout string = "unix"
+const unixMilliLayout string = "unixms"
+
+// namedLayouts maps the names of the time package layouts, in lower case, to the layouts themselves
+var namedLayouts = map[string]string{
+	"ansic":       time.ANSIC,
+	"unixdate":    time.UnixDate,
+	"rubydate":    time.RubyDate,
+	"rfc822":      time.RFC822,
+	"rfc822z":     time.RFC822Z,
+	"rfc850":      time.RFC850,
+	"rfc1123":     time.RFC1123,
+	"rfc1123z":    time.RFC1123Z,
+	"rfc3339":     time.RFC3339,
+	"rfc3339nano": time.RFC3339Nano,
+	"kitchen":     time.Kitchen,
+	"datetime":    "2006-01-02 15:04:05",
+	"date":        "2006-01-02",
+	"time":        "15:04:05",
+}
+
+// timeLayout returns the layout for a "layout=" directive, which is either a layout name, like "RFC1123" or "date",
+// "unix" and "unixms" for timestamps, or a layout written like the time package ones
+func timeLayout(name string) string {
+	lower := strings.ToLower(name)
+	if lower == unixLayout || lower == unixMilliLayout {
+		return lower
+	}
+	if layout, found := namedLayouts[lower]; found {
+		return layout
+	}
+	return name
+}
+
+// parseTime parses a time with the field layout, in the field time zone when the value has none
+func (c converter) parseTime(data string) (time.Time, error) {
+	switch c.layout {
+	case unixLayout, unixMilliLayout:
+		timestamp, err := strconv.ParseInt(data, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if c.layout == unixLayout {
+			return time.Unix(timestamp, 0).In(c.timeLocation()), nil
+		}
+		return time.UnixMilli(timestamp).In(c.timeLocation()), nil
+	case "":
+		return time.ParseInLocation(time.RFC3339, data, c.timeLocation())
+	default:
+		return time.ParseInLocation(c.layout, data, c.timeLocation())
+	}
+}
+
+// formatTime shows a time on usage messages and reports with the field layout
+func (c converter) formatTime(value time.Time) string {
+	if value.IsZero() {
+		return ""
+	}
+
+	switch c.layout {
+	case unixLayout:
+		return strconv.FormatInt(value.Unix(), 10)
+	case unixMilliLayout:
+		return strconv.FormatInt(value.UnixMilli(), 10)
+	case "":
+		return value.Format(time.RFC3339Nano)
+	default:
+		return value.Format(c.layout)
+	}
+}
+
+func (c converter) timeLocation() *time.Location {
+	if c.location == nil {
+		return time.UTC
+	}
+	return c.location
+}
@@ -0,0 +1,266 @@
+package openvvar
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const minString string = "min"
+const maxString string = "max"
+const rangeString string = "range"
+const lenString string = "len"
+const minLenString string = "minlen"
+const maxLenString string = "maxlen"
+const patternString string = "pattern"
+const urlString string = "url"
+const hostPortString string = "hostport"
+const fileString string = "file"
+const nonEmptyString string = "nonempty"
+
+// constraint is a validation directive, checking the whole field value or each element for slices
+type constraint struct {
+	Directive  string
+	OnElements bool
+	// Check returns the reason why the value doesn't satisfy the constraint, or an empty string if it does
+	Check func(value reflect.Value) string
+}
+
+// parseConstraint adds the constraint for a validation directive to the field
+func (f *fieldConfig) parseConstraint(directive tagDirective) error {
+	name, value := directive.String(), directive.Value
+
+	switch directive.Name {
+	case minString:
+		return f.addBound(name, value, -1)
+	case maxString:
+		return f.addBound(name, value, 1)
+	case rangeString:
+		bounds := strings.SplitN(value, "..", 2)
+		if len(bounds) != 2 {
+			return &TypeConversionError{Err: fmt.Errorf("range must be written as min..max"), Value: value}
+		}
+		if err := f.addBound(name, bounds[0], -1); err != nil {
+			return err
+		}
+		return f.addBound(name, bounds[1], 1)
+	case lenString:
+		return f.addLength(name, value, 0)
+	case minLenString:
+		return f.addLength(name, value, -1)
+	case maxLenString:
+		return f.addLength(name, value, 1)
+	case patternString:
+		pattern, err := regexp.Compile(fmt.Sprintf("^(?:%s)$", value))
+		if err != nil {
+			return &TypeConversionError{Err: err, Value: value}
+		}
+		return f.addStringConstraint(name, func(data string) string {
+			if !pattern.MatchString(data) {
+				return fmt.Sprintf("must match pattern %s", value)
+			}
+			return ""
+		})
+	case urlString:
+		return f.addStringConstraint(name, func(data string) string {
+			if parsed, err := url.Parse(data); err != nil || !parsed.IsAbs() || parsed.Host == "" {
+				return "must be an absolute URL"
+			}
+			return ""
+		})
+	case hostPortString:
+		return f.addStringConstraint(name, func(data string) string {
+			_, port, err := net.SplitHostPort(data)
+			if err != nil {
+				return "must be a host:port address"
+			}
+			if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+				return "must have a port between 0 and 65535"
+			}
+			return ""
+		})
+	case fileString:
+		return f.addStringConstraint(name, func(data string) string {
+			if info, err := os.Stat(data); err != nil || info.IsDir() {
+				return "must be an existing file"
+			}
+			return ""
+		})
+	case nonEmptyString:
+		f.Constraints = append(f.Constraints, constraint{
+			Directive: name,
+			Check: func(value reflect.Value) string {
+				if value.IsZero() || f.Converter.hasLength(value.Type()) && value.Len() == 0 {
+					return "must not be empty"
+				}
+				return ""
+			},
+		})
+		return nil
+	}
+
+	return &InvalidTagError{Field: f.Name, Directive: directive.Name, Reason: "unknown directive"}
+}
+
+// addBound adds a min (signal -1) or max (signal 1) constraint for numbers and durations
+func (f *fieldConfig) addBound(directive string, data string, signal int) error {
+	boundType := f.elementType()
+	if !isNumber(boundType.Kind()) {
+		return &InvalidTypeForDefaultValuesError{Type: boundType.Kind().String()}
+	}
+
+	bound := reflect.New(boundType).Elem()
+	if err := f.elementConverter().convert(strings.TrimSpace(data), bound); err != nil {
+		return err
+	}
+	formatted := f.elementConverter().format(bound)
+
+	f.Constraints = append(f.Constraints, constraint{
+		Directive:  directive,
+		OnElements: true,
+		Check: func(value reflect.Value) string {
+			if compareNumbers(value, bound)*signal > 0 {
+				if signal < 0 {
+					return fmt.Sprintf("must be at least %s", formatted)
+				}
+				return fmt.Sprintf("must be at most %s", formatted)
+			}
+			return ""
+		},
+	})
+
+	return nil
+}
+
+// addLength adds a length constraint for strings, slices, maps and bytes, exact for signal 0, minimum for -1 and maximum for 1
+func (f *fieldConfig) addLength(directive string, data string, signal int) error {
+	valueType := f.Converter.indirectType(f.Value.Type())
+	if valueType.Kind() != reflect.String && !f.Converter.hasLength(valueType) {
+		return &InvalidTypeForDefaultValuesError{Type: valueType.Kind().String()}
+	}
+
+	length, err := strconv.Atoi(strings.TrimSpace(data))
+	if err != nil {
+		return &TypeConversionError{Err: err, Value: data}
+	}
+
+	f.Constraints = append(f.Constraints, constraint{
+		Directive: directive,
+		Check: func(value reflect.Value) string {
+			actual := 0
+			if value.Kind() == reflect.String {
+				actual = utf8.RuneCountInString(value.String())
+			} else {
+				actual = value.Len()
+			}
+
+			switch {
+			case signal == 0 && actual != length:
+				return fmt.Sprintf("must have length %d", length)
+			case signal < 0 && actual < length:
+				return fmt.Sprintf("must have length at least %d", length)
+			case signal > 0 && actual > length:
+				return fmt.Sprintf("must have length at most %d", length)
+			}
+			return ""
+		},
+	})
+
+	return nil
+}
+
+// addStringConstraint adds a constraint checked on strings, or on each element of string slices
+func (f *fieldConfig) addStringConstraint(directive string, check func(string) string) error {
+	if kind := f.elementType().Kind(); kind != reflect.String {
+		return &InvalidTypeForDefaultValuesError{Type: kind.String()}
+	}
+
+	f.Constraints = append(f.Constraints, constraint{
+		Directive:  directive,
+		OnElements: true,
+		Check: func(value reflect.Value) string {
+			return check(value.String())
+		},
+	})
+
+	return nil
+}
+
+// checkConstraints validates the field against all its constraints, skipping fields left unset and empty
+func (f *fieldConfig) checkConstraints() {
+	if len(f.Provided) == 0 && f.Value.IsZero() {
+		return
+	}
+
+	value, ok := f.indirect()
+	if !ok {
+		return
+	}
+
+	for _, c := range f.Constraints {
+		values := []reflect.Value{value}
+		if c.OnElements {
+			values = f.elements()
+		}
+
+		for _, value := range values {
+			if reason := c.Check(value); reason != "" {
+				f.Errors = append(f.Errors, newFieldError(f, f.source(), &ConstraintViolationError{
+					Constraint: c.Directive,
+					Reason:     reason,
+					Value:      f.Converter.format(value),
+					Field:      f.Name,
+					Key:        f.Key,
+					Source:     f.source(),
+				}))
+			}
+		}
+	}
+}
+
+func isInteger(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+func isNumber(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// compareNumbers returns -1, 0 or 1 if a is less than, equal or greater than b, both being of the same kind
+func compareNumbers(a, b reflect.Value) int {
+	switch a.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return compare(a.Int() < b.Int(), a.Int() > b.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return compare(a.Uint() < b.Uint(), a.Uint() > b.Uint())
+	default:
+		return compare(a.Float() < b.Float(), a.Float() > b.Float())
+	}
+}
+
+func compare(less, greater bool) int {
+	if less {
+		return -1
+	}
+	if greater {
+		return 1
+	}
+	return 0
+}